@@ -0,0 +1,44 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStripANSI(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{
+			name:    "stripped",
+			options: []Option{WithStripANSI()},
+			want:    "my log entry: failed",
+		},
+		{
+			name: "kept",
+			want: "my \x1b[1mlog\x1b[0m entry: \x1b[31mfailed\x1b[0m",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.Info("my \x1b[1mlog\x1b[0m entry: \x1b[31mfailed\x1b[0m")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["message"] != tt.want {
+				t.Errorf("unexpected message = %q; want = %q", got["message"], tt.want)
+			}
+		})
+	}
+}
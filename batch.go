@@ -0,0 +1,90 @@
+package stackdriver
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BatchFormatter accumulates entries as a single JSON array, e.g. to send
+// them to the Cloud Logging API in one request.
+type BatchFormatter struct {
+	Formatter *Formatter
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// NewBatchFormatter returns a new BatchFormatter, formatting entries with a
+// Formatter configured with options.
+func NewBatchFormatter(options ...Option) *BatchFormatter {
+	return &BatchFormatter{
+		Formatter: NewFormatter(options...),
+	}
+}
+
+// Append formats e and adds it to the batch.
+func (b *BatchFormatter) Append(e *logrus.Entry) error {
+	f := b.Formatter
+	if f == nil {
+		f = &Formatter{}
+	}
+	// The entry remains the caller's, so a copy is formatted.
+	e = copyEntry(e)
+
+	// Walking the stack from Format would locate Append, so the caller is
+	// resolved here unless logrus reported it.
+	if e.Caller == nil || f.CallerSkip > 0 || f.skipFrame(*e.Caller) {
+		if frame, ok := f.callerFrom(1); ok {
+			e.Caller = &frame
+			// The frames above the caller have been skipped already.
+			if f.CallerSkip > 0 {
+				fmtr := *f
+				fmtr.CallerSkip = 0
+				f = &fmtr
+			}
+		}
+	}
+
+	entry, err := f.Format(e)
+	if err != nil {
+		return err
+	}
+	entry = bytes.TrimSpace(entry)
+	if len(entry) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf.Len() == 0 {
+		b.buf.WriteByte('[')
+	} else {
+		b.buf.WriteByte(',')
+	}
+	b.buf.Write(entry)
+	return nil
+}
+
+// Bytes returns the entries appended so far as a JSON array.
+func (b *BatchFormatter) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf.Len() == 0 {
+		return []byte("[]")
+	}
+	out := make([]byte, b.buf.Len(), b.buf.Len()+1)
+	copy(out, b.buf.Bytes())
+	return append(out, ']')
+}
+
+// Reset removes all entries from the batch.
+func (b *BatchFormatter) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Reset()
+}
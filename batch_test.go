@@ -0,0 +1,76 @@
+package stackdriver
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBatchFormatter(t *testing.T) {
+	b := NewBatchFormatter(WithService("test"))
+
+	if got, want := string(b.Bytes()), "[]"; got != want {
+		t.Errorf("unexpected empty batch = %s; want = %s", got, want)
+	}
+
+	logger := logrus.New()
+	for _, msg := range []string{"first entry", "second entry", "third entry"} {
+		e := logrus.NewEntry(logger)
+		e.Message = msg
+		e.Level = logrus.InfoLevel
+		if err := b.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected batch = %s: %v", b.Bytes(), err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("unexpected entries = %d; want = %d", len(got), 3)
+	}
+	for i, want := range []string{"first entry", "second entry", "third entry"} {
+		if got[i]["message"] != want {
+			t.Errorf("unexpected message = %v; want = %v", got[i]["message"], want)
+		}
+		sourceLocation, _ := got[i]["sourceLocation"].(map[string]interface{})
+		if want := "TestBatchFormatter"; sourceLocation["function"] != want {
+			t.Errorf("unexpected function = %v; want = %v", sourceLocation["function"], want)
+		}
+	}
+
+	b.Reset()
+	if got, want := string(b.Bytes()), "[]"; got != want {
+		t.Errorf("unexpected batch after reset = %s; want = %s", got, want)
+	}
+}
+
+func TestBatchFormatterKeepsEntry(t *testing.T) {
+	b := NewBatchFormatter()
+
+	err := errors.New("test error")
+	e := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		logrus.ErrorKey:       err,
+		DefaultOperationIdKey: "request",
+	})
+	e.Message = "my log entry"
+	e.Level = logrus.ErrorLevel
+
+	if err := b.Append(e); err != nil {
+		t.Fatal(err)
+	}
+
+	want := logrus.Fields{
+		logrus.ErrorKey:       err,
+		DefaultOperationIdKey: "request",
+	}
+	if !reflect.DeepEqual(e.Data, want) {
+		t.Errorf("unexpected fields = %# v; want = %# v", pretty.Formatter(e.Data), pretty.Formatter(want))
+	}
+}
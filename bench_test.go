@@ -0,0 +1,142 @@
+package stackdriver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func BenchmarkFormat(b *testing.B) {
+	f := NewFormatter()
+	e := logrus.NewEntry(logrus.New()).WithField("foo", "bar")
+	e.Message = "my log entry"
+	e.Level = logrus.InfoLevel
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Format(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormatError(b *testing.B) {
+	f := NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+	)
+	e := logrus.NewEntry(logrus.New()).WithField("foo", "bar")
+	e.Message = "my log entry"
+	e.Level = logrus.ErrorLevel
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Format(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormatWithoutSourceLocation(b *testing.B) {
+	f := NewFormatter(
+		WithoutSourceLocation(),
+	)
+	e := logrus.NewEntry(logrus.New()).WithField("foo", "bar")
+	e.Message = "my log entry"
+	e.Level = logrus.InfoLevel
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Format(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSkipCache(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		f    *Formatter
+	}{
+		{
+			name: "uncached",
+			f: &Formatter{
+				StackSkip: []string{"github.com/sirupsen/logrus"},
+			},
+		},
+		{
+			name: "cached",
+			f:    NewFormatter(),
+		},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			logger.Formatter = bb.f
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Info("my log entry")
+			}
+		})
+	}
+}
+
+// BenchmarkLocation compares entries with a source location to errors, which
+// also get a report location. Both resolve their origin from a single walk
+// of the stack, so they should perform alike.
+func BenchmarkLocation(b *testing.B) {
+	for _, level := range []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel} {
+		b.Run(level.String(), func(b *testing.B) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			logger.Formatter = NewFormatter()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Log(level, "my log entry")
+			}
+		})
+	}
+}
+
+func BenchmarkFormatBuffer(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		buf  *bytes.Buffer
+	}{
+		{
+			name: "without buffer",
+		},
+		{
+			name: "with buffer",
+			buf:  new(bytes.Buffer),
+		},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			f := NewFormatter()
+			e := logrus.NewEntry(logrus.New()).WithField("foo", "bar")
+			e.Message = "my log entry"
+			e.Level = logrus.InfoLevel
+			e.Buffer = bb.buf
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if bb.buf != nil {
+					bb.buf.Reset()
+				}
+				if _, err := f.Format(e); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFormatBuffer(t *testing.T) {
+	buf := bytes.NewBufferString("written by a hook\n")
+
+	e := logrus.NewEntry(logrus.New())
+	e.Message = "my log entry"
+	e.Level = logrus.InfoLevel
+	e.Buffer = buf
+
+	b, err := NewFormatter(WithoutSourceLocation()).Format(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected error = %v; entry = %s", err, b)
+	}
+	if want := "my log entry"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+	if want := "written by a hook\n" + string(b); buf.String() != want {
+		t.Errorf("unexpected buffer = %q; want = %q", buf.String(), want)
+	}
+}
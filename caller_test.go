@@ -0,0 +1,101 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReportCaller(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		log  func(*logrus.Logger)
+		key  string
+		want map[string]interface{}
+	}{
+		{
+			name: "info",
+			log:  func(l *logrus.Logger) { l.Info("my log entry") },
+			key:  "sourceLocation",
+			want: map[string]interface{}{
+				"file":     "github.com/connctd/logrus-stackdriver-formatter/caller_test.go",
+				"line":     "22",
+				"function": "TestReportCaller.func1",
+			},
+		},
+		{
+			name: "error",
+			log:  func(l *logrus.Logger) { l.Error("my log entry") },
+			key:  "reportLocation",
+			want: map[string]interface{}{
+				"filePath":     "github.com/connctd/logrus-stackdriver-formatter/caller_test.go",
+				"lineNumber":   32.0,
+				"functionName": "TestReportCaller.func2",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+			logger.SetReportCaller(true)
+
+			tt.log(logger)
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			location := got[tt.key]
+			if context, ok := got["context"].(map[string]interface{}); ok && location == nil {
+				location = context[tt.key]
+			}
+
+			if !reflect.DeepEqual(location, tt.want) {
+				t.Errorf("unexpected %s = %# v; want = %# v", tt.key, pretty.Formatter(location), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestCallerSkip(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		reportCaller bool
+	}{
+		{name: "stack"},
+		{name: "report caller", reportCaller: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithCallerSkip(1),
+			)
+			logger.SetReportCaller(tt.reportCaller)
+
+			logErrorFromHelper(logger)
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			want := map[string]interface{}{
+				"filePath":     "github.com/connctd/logrus-stackdriver-formatter/caller_test.go",
+				"lineNumber":   84.0,
+				"functionName": "TestCallerSkip.func1",
+			}
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["reportLocation"], want) {
+				t.Errorf("unexpected reportLocation = %# v; want = %# v", pretty.Formatter(context["reportLocation"]), pretty.Formatter(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestClock(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithClock(func() time.Time {
+			return time.Date(2018, 9, 5, 10, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+		}),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "2018-09-05T08:30:00Z"; got["timestamp"] != want {
+		t.Errorf("unexpected timestamp = %v; want = %v", got["timestamp"], want)
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	now := time.Date(2018, 9, 5, 8, 30, 0, 123456789, time.UTC)
+
+	for _, tt := range []struct {
+		options []Option
+		want    string
+	}{
+		{
+			want: "2018-09-05T08:30:00.123456789Z",
+		},
+		{
+			options: []Option{WithTimestampFormat(time.RFC3339)},
+			want:    "2018-09-05T08:30:00Z",
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(append(tt.options, WithClock(func() time.Time {
+			return now
+		}))...)
+
+		logger.Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["timestamp"] != tt.want {
+			t.Errorf("unexpected timestamp = %v; want = %v", got["timestamp"], tt.want)
+		}
+	}
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	now := time.Date(2018, 9, 5, 8, 30, 0, 123456789, time.UTC)
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithClock(func() time.Time {
+		return now
+	}))
+
+	logger.Info("my log entry")
+
+	var got struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !got.Timestamp.Equal(now) {
+		t.Errorf("unexpected timestamp = %v; want = %v", got.Timestamp, now)
+	}
+}
+
+func TestProtoTimestamp(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithProtoTimestamp(),
+		WithClock(func() time.Time {
+			return time.Date(2018, 9, 5, 8, 30, 0, 123456789, time.UTC)
+		}),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"seconds": 1536136200.0,
+		"nanos":   123456789.0,
+	}
+
+	if !reflect.DeepEqual(got["timestamp"], want) {
+		t.Errorf("unexpected timestamp = %# v; want = %# v", pretty.Formatter(got["timestamp"]), pretty.Formatter(want))
+	}
+}
+
+func TestExtraTimeKey(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	for _, tt := range []struct {
+		name    string
+		options []Option
+	}{
+		{
+			name: "context",
+		},
+		{
+			name:    "flat payload",
+			options: []Option{WithFlatPayload()},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(append(tt.options, WithExtraTimeKey("@timestamp"))...)
+
+			logger.WithField("foo", "bar").Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["timestamp"] == nil || got["@timestamp"] != got["timestamp"] {
+				t.Errorf("unexpected @timestamp = %v; want = %v", got["@timestamp"], got["timestamp"])
+			}
+		})
+	}
+}
+
+func TestExtraTimeKeyCollision(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	t.Run("field", func(t *testing.T) {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(
+			WithFlatPayload(),
+			WithExtraTimeKey("time"),
+		)
+
+		logger.WithField("time", "user").Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if want := "user"; got["time"] != want {
+			t.Errorf("unexpected time = %v; want = %v", got["time"], want)
+		}
+	})
+
+	t.Run("reserved", func(t *testing.T) {
+		f := NewFormatter(WithExtraTimeKey("timestamp"))
+		if f.ExtraTimeKey != "" {
+			t.Errorf("unexpected extra time key = %v", f.ExtraTimeKey)
+		}
+
+		b, err := f.Format(logrus.WithField("foo", "bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(b, []byte(`"timestamp":`)); n != 1 {
+			t.Errorf("unexpected timestamps = %d; want = 1 in %s", n, b)
+		}
+	})
+}
+
+func TestWithoutTimestamp(t *testing.T) {
+	defer func(skip bool) { skipTimestamp = skip }(skipTimestamp)
+	skipTimestamp = false
+
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    bool
+	}{
+		{
+			name: "default",
+			want: true,
+		},
+		{
+			name:    "without timestamp",
+			options: []Option{WithoutTimestamp()},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if _, ok := got["timestamp"]; ok != tt.want {
+				t.Errorf("unexpected timestamp = %v; want = %v", ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package stackdriver
+
+import "reflect"
+
+const cyclic = "[cyclic]"
+
+// visitor tracks the maps and slices on the path to the value currently
+// processed, to detect those referencing themselves.
+type visitor map[uintptr]bool
+
+// enter marks the container v as visited. It reports false if v is already
+// on the path, i.e. it references itself.
+func (vs visitor) enter(v interface{}) bool {
+	ptr := reflect.ValueOf(v).Pointer()
+	if ptr == 0 {
+		return true
+	}
+	if vs[ptr] {
+		return false
+	}
+	vs[ptr] = true
+	return true
+}
+
+// leave removes the container v from the path.
+func (vs visitor) leave(v interface{}) {
+	delete(vs, reflect.ValueOf(v).Pointer())
+}
@@ -0,0 +1,60 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCyclicFields(t *testing.T) {
+	cyclicMap := map[string]interface{}{
+		"token": "secret-token",
+	}
+	cyclicMap["self"] = cyclicMap
+
+	cyclicSlice := make([]interface{}, 2)
+	cyclicSlice[0] = "secret-token"
+	cyclicSlice[1] = cyclicSlice
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithRedactValuePattern(regexp.MustCompile(`secret-\w+`), "[REDACTED]"),
+		WithMaxDepth(10),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"map":   cyclicMap,
+			"slice": cyclicSlice,
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected output = %s: %v", out.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"map": map[string]interface{}{
+			"token": "[REDACTED]",
+			"self":  "[cyclic]",
+		},
+		"slice": []interface{}{
+			"[REDACTED]",
+			"[cyclic]",
+		},
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+}
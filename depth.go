@@ -0,0 +1,57 @@
+package stackdriver
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const truncated = "[truncated]"
+
+// limitDepth replaces the maps and slices in data, which are nested deeper
+// than the configured maximum depth. The fields themselves are at depth 1.
+func (f *Formatter) limitDepth(data map[string]interface{}) {
+	visiting := make(visitor)
+	for k, v := range data {
+		data[k] = f.limitValueDepth(v, 1, visiting)
+	}
+}
+
+// limitValueDepth returns v with containers nested deeper than the maximum
+// depth replaced. Containers are copied rather than modified in place, those
+// referencing themselves are replaced by "[cyclic]".
+func (f *Formatter) limitValueDepth(v interface{}, depth int, visiting visitor) interface{} {
+	switch v.(type) {
+	case map[string]string, map[string]interface{}, logrus.Fields, []string, []interface{}:
+	default:
+		return v
+	}
+	if depth > f.MaxDepth {
+		return truncated
+	}
+
+	if !visiting.enter(v) {
+		return cyclic
+	}
+	defer visiting.leave(v)
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = f.limitValueDepth(val, depth+1, visiting)
+		}
+		return m
+	case logrus.Fields:
+		m := make(logrus.Fields, len(v))
+		for k, val := range v {
+			m[k] = f.limitValueDepth(val, depth+1, visiting)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = f.limitValueDepth(val, depth+1, visiting)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,80 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMaxDepth(t *testing.T) {
+	cyclic := map[string]interface{}{
+		"foo": "bar",
+	}
+	cyclic["self"] = cyclic
+
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+	}{
+		{
+			name: "nested",
+			fields: logrus.Fields{
+				"a": map[string]interface{}{
+					"b": []interface{}{
+						map[string]interface{}{
+							"c": 1,
+						},
+						"d",
+					},
+				},
+				"e": "f",
+			},
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": []interface{}{
+						"[truncated]",
+						"d",
+					},
+				},
+				"e": "f",
+			},
+		},
+		{
+			name: "cyclic",
+			fields: logrus.Fields{
+				"a": cyclic,
+			},
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"foo":  "bar",
+					"self": "[cyclic]",
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithMaxDepth(2),
+			)
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.want) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
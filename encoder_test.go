@@ -0,0 +1,85 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func encodeDuration(key string, v interface{}) (interface{}, bool) {
+	if d, ok := v.(time.Duration); ok {
+		return d.String(), true
+	}
+	return nil, false
+}
+
+func TestValueEncoder(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithValueEncoder(encodeDuration),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"elapsed": 1500 * time.Millisecond,
+			"count":   3,
+			"foo":     "bar",
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"elapsed": "1.5s",
+		"count":   3.0,
+		"foo":     "bar",
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+}
+
+func TestDurationUnit(t *testing.T) {
+	for _, tt := range []struct {
+		unit time.Duration
+		want interface{}
+	}{
+		{time.Second, 1.5},
+		{time.Millisecond, 1500.0},
+		{time.Nanosecond, 1500000000.0},
+	} {
+		t.Run(tt.unit.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithDurationUnit(tt.unit),
+			)
+
+			logger.WithField("elapsed", 1500*time.Millisecond).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			want := map[string]interface{}{
+				"elapsed": tt.want,
+			}
+			if !reflect.DeepEqual(context["data"], want) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestErrorField(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{
+			name:  "error",
+			value: errors.New("test error"),
+			want:  "my log entry: test error",
+		},
+		{
+			name:  "nil",
+			value: nil,
+			want:  "my log entry",
+		},
+		{
+			name:  "int",
+			value: 42,
+			want:  "my log entry: 42",
+		},
+		{
+			name:  "struct",
+			value: struct{ Code int }{Code: 42},
+			want:  "my log entry: {42}",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.WithField("error", tt.value).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["message"] != tt.want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], tt.want)
+			}
+
+			context, _ := got["context"].(map[string]interface{})
+			if data, ok := context["data"].(map[string]interface{}); ok {
+				if _, ok := data["error"]; ok {
+					t.Errorf("unexpected error field = %v", data["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestKeepErrorField(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithKeepErrorField(),
+	)
+
+	logger.WithError(errors.New("test error")).Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "my log entry: test error"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	data, _ := context["data"].(map[string]interface{})
+	if want := "test error"; data["error"] != want {
+		t.Errorf("unexpected error field = %v; want = %v", data["error"], want)
+	}
+}
+
+// joinedError bundles errors like the ones returned by errors.Join, which
+// requires Go 1.20.
+type joinedError []error
+
+func (e joinedError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e joinedError) Unwrap() []error {
+	return e
+}
+
+func TestJoinedErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		wantMsg    string
+		wantErrors interface{}
+	}{
+		{
+			name:       "joined",
+			err:        joinedError{errors.New("first error"), errors.New("second error")},
+			wantMsg:    "my log entry:\n- first error\n- second error",
+			wantErrors: []interface{}{"first error", "second error"},
+		},
+		{
+			name:    "single",
+			err:     errors.New("first error"),
+			wantMsg: "my log entry: first error",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithKeepErrorField(),
+			)
+
+			logger.WithError(tt.err).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["message"] != tt.wantMsg {
+				t.Errorf("unexpected message = %q; want = %q", got["message"], tt.wantMsg)
+			}
+
+			context, _ := got["context"].(map[string]interface{})
+			data, _ := context["data"].(map[string]interface{})
+			if !reflect.DeepEqual(data["errors"], tt.wantErrors) {
+				t.Errorf("unexpected errors = %# v; want = %# v", pretty.Formatter(data["errors"]), pretty.Formatter(tt.wantErrors))
+			}
+		})
+	}
+}
+
+type codedError struct{}
+
+func (codedError) Error() string { return "not found" }
+func (codedError) Code() string  { return "NOT_FOUND" }
+func (codedError) Type() string  { return "client" }
+
+func TestErrorDetails(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+	}{
+		{
+			name:   "coded error",
+			fields: logrus.Fields{"error": fmt.Errorf("loading user: %w", codedError{})},
+			want: map[string]interface{}{
+				"errorCode": "NOT_FOUND",
+				"errorType": "client",
+			},
+		},
+		{
+			name: "companion fields",
+			fields: logrus.Fields{
+				"error":     codedError{},
+				"errorCode": "GONE",
+			},
+			want: map[string]interface{}{
+				"errorCode": "GONE",
+				"errorType": "client",
+			},
+		},
+		{
+			name:   "plain error",
+			fields: logrus.Fields{"error": errors.New("test error")},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.WithFields(tt.fields).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.want) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestErrorFieldKey(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		key     string
+		want    string
+		kept    bool
+	}{
+		{
+			name: "default",
+			key:  "error",
+			want: "my log entry: test error",
+		},
+		{
+			name:    "custom key",
+			options: []Option{WithErrorFieldKey("err")},
+			key:     "err",
+			want:    "my log entry: test error",
+		},
+		{
+			name:    "default key with custom key",
+			options: []Option{WithErrorFieldKey("err")},
+			key:     "error",
+			want:    "my log entry",
+			kept:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.WithField(tt.key, errors.New("test error")).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["message"] != tt.want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], tt.want)
+			}
+			context, _ := got["context"].(map[string]interface{})
+			data, _ := context["data"].(map[string]interface{})
+			if _, kept := data[tt.key]; kept != tt.kept {
+				t.Errorf("unexpected %s field kept = %v; want = %v", tt.key, kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestErrorSliceField(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "errors",
+			value: []error{errors.New("first error"), errors.New("second error")},
+			want:  []interface{}{"first error", "second error"},
+		},
+		{
+			name:  "values",
+			value: []interface{}{errors.New("first error"), 42},
+			want:  []interface{}{"first error", 42.0},
+		},
+		{
+			name:  "error",
+			value: errors.New("first error"),
+			want:  "first error",
+		},
+		{
+			name:  "values without errors",
+			value: []interface{}{"first", 42},
+			want:  []interface{}{"first", 42.0},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.WithField("failures", tt.value).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			data, _ := context["data"].(map[string]interface{})
+			if !reflect.DeepEqual(data["failures"], tt.want) {
+				t.Errorf("unexpected failures = %# v; want = %# v", pretty.Formatter(data["failures"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+func TestDowngradeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		severity string
+		message  string
+		errorCtx bool
+	}{
+		{
+			name:     "canceled",
+			err:      fmt.Errorf("fetching user: %w", context.Canceled),
+			severity: "WARNING",
+			message:  "my log entry: fetching user: context canceled",
+		},
+		{
+			name:     "regular error",
+			err:      errors.New("test error"),
+			severity: "ERROR",
+			message:  "my log entry: test error",
+			errorCtx: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithService("test"),
+				WithDowngradeErrors(isCanceled),
+			)
+
+			logger.WithError(tt.err).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["severity"] != tt.severity {
+				t.Errorf("unexpected severity = %v; want = %v", got["severity"], tt.severity)
+			}
+			if got["message"] != tt.message {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], tt.message)
+			}
+			if _, ok := got["serviceContext"]; ok != tt.errorCtx {
+				t.Errorf("unexpected serviceContext = %v; want = %v", ok, tt.errorCtx)
+			}
+			errorContext, _ := got["context"].(map[string]interface{})
+			if _, ok := errorContext["reportLocation"]; ok != tt.errorCtx {
+				t.Errorf("unexpected reportLocation = %v; want = %v", ok, tt.errorCtx)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package stackdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stackTracer is implemented by errors of github.com/pkg/errors, which record
+// the stack at the point they were created.
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// errorStack returns the frames of the deepest stack trace recorded in the
+// chain of err, or nil if there is none.
+func errorStack(err error) []runtime.Frame {
+	var st errors.StackTrace
+	for ; err != nil; err = errors.Unwrap(err) {
+		if tracer, ok := err.(stackTracer); ok {
+			st = tracer.StackTrace()
+		}
+	}
+	if len(st) == 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, len(st))
+	for i, frame := range st {
+		pcs[i] = uintptr(frame)
+	}
+
+	var frames []runtime.Frame
+	callers := runtime.CallersFrames(pcs)
+	for {
+		frame, more := callers.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			frames = append(frames, frame)
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// frameLocation returns the file path and function name of frame, formatted
+// the same way go-stack formats them with "%+s" and "%n".
+func frameLocation(frame runtime.Frame) (file, function string) {
+	file = frame.File
+	if i := strings.LastIndex(file, "/"); i != -1 {
+		file = file[strings.LastIndex(file[:i], "/")+1:]
+	}
+	if i := strings.LastIndex(frame.Function, "/"); i != -1 {
+		file = frame.Function[:i] + "/" + file
+	}
+
+	function = frame.Function
+	if i := strings.LastIndex(function, "/"); i != -1 {
+		function = function[i+1:]
+	}
+	if i := strings.Index(function, "."); i != -1 {
+		function = function[i+1:]
+	}
+	return file, function
+}
+
+// multiError is implemented by errors bundling several errors, e.g. the ones
+// returned by errors.Join.
+type multiError interface {
+	Unwrap() []error
+}
+
+// joinedErrors returns the messages of the errors bundled by err, or nil if
+// err is not a multiError.
+func joinedErrors(err error) []string {
+	multi, ok := err.(multiError)
+	if !ok {
+		return nil
+	}
+
+	var msgs []string
+	for _, err := range multi.Unwrap() {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return msgs
+}
+
+// errorDetails returns the code and type of the first errors in the chain of
+// err, which implement Code() or Type().
+func errorDetails(err error) (code, typ string) {
+	var coder interface{ Code() string }
+	if errors.As(err, &coder) {
+		code = coder.Code()
+	}
+	var typer interface{ Type() string }
+	if errors.As(err, &typer) {
+		typ = typer.Type()
+	}
+	return code, typ
+}
+
+// errorStrings converts an error, a slice of errors, or the errors in a slice
+// of values to their messages. Errors marshaling themselves and values holding
+// no errors are reported as not converted.
+func errorStrings(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case json.Marshaler:
+		return nil, false
+	case error:
+		return fmt.Sprint(v), true
+	case []error:
+		msgs := make([]string, len(v))
+		for i, err := range v {
+			msgs[i] = fmt.Sprint(err)
+		}
+		return msgs, true
+	case []interface{}:
+		var values []interface{}
+		for i, val := range v {
+			if err, ok := val.(error); ok {
+				// The slice may be shared between entries, so it's copied
+				// rather than modified in place.
+				if values == nil {
+					values = append([]interface{}(nil), v...)
+				}
+				values[i] = err.Error()
+			}
+		}
+		return values, values != nil
+	}
+	return nil, false
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func ExampleLogError() {
+func Example_logError() {
 	logger := logrus.New()
 	logger.Out = os.Stdout
 	logger.Formatter = stackdriver.NewFormatter(
@@ -24,6 +24,6 @@ func ExampleLogError() {
 	}
 
 	// Output:
-	// {"message":"application up and running","severity":"INFO","context":{},"sourceLocation":{"file":"github.com/connctd/logrus-stackdriver-formatter/example_test.go","line":"19","function":"ExampleLogError"}}
-	// {"serviceContext":{"service":"test-service","version":"v0.1.0"},"message":"unable to parse integer: strconv.ParseInt: parsing \"text\": invalid syntax","severity":"ERROR","context":{"reportLocation":{"filePath":"github.com/connctd/logrus-stackdriver-formatter/example_test.go","lineNumber":23,"functionName":"ExampleLogError"}}}
+	// {"message":"application up and running","severity":"INFO","sourceLocation":{"file":"github.com/connctd/logrus-stackdriver-formatter/example_test.go","line":"19","function":"Example_logError"}}
+	// {"serviceContext":{"service":"test-service","version":"v0.1.0"},"message":"unable to parse integer: strconv.ParseInt: parsing \"text\": invalid syntax","severity":"ERROR","context":{"reportLocation":{"filePath":"github.com/connctd/logrus-stackdriver-formatter/example_test.go","lineNumber":23,"functionName":"Example_logError"}},"sourceLocation":{"file":"github.com/connctd/logrus-stackdriver-formatter/example_test.go","line":"23","function":"Example_logError"}}
 }
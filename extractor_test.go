@@ -0,0 +1,66 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+type tenantKey struct{}
+
+func TestContextExtractor(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithContextExtractor(func(ctx context.Context) logrus.Fields {
+			return logrus.Fields{
+				"tenant":          ctx.Value(tenantKey{}),
+				DefaultSubjectKey: "context-user",
+			}
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+
+	logger.WithContext(ctx).
+		WithField(DefaultSubjectKey, "explicit-user").
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	context, _ := got["context"].(map[string]interface{})
+
+	want := map[string]interface{}{
+		"tenant": "acme",
+	}
+	if !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+
+	if want := "explicit-user"; context["user"] != want {
+		t.Errorf("unexpected user = %v; want = %v", context["user"], want)
+	}
+}
+
+func TestContextExtractorWithoutContext(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithContextExtractor(func(ctx context.Context) logrus.Fields {
+			t.Error("unexpected call to the context extractor")
+			return nil
+		}),
+	)
+
+	logger.Info("my log entry")
+}
@@ -0,0 +1,22 @@
+package stackdriver
+
+// filterFields removes the fields of data, which aren't in the allowlist, if
+// there is one, and those in the denylist.
+func (f *Formatter) filterFields(data map[string]interface{}) {
+	for k := range data {
+		if len(f.FieldAllowlist) > 0 && !contains(f.FieldAllowlist, k) {
+			delete(data, k)
+		} else if contains(f.FieldDenylist, k) {
+			delete(data, k)
+		}
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
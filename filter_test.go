@@ -0,0 +1,116 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFieldAllowlist(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithFieldAllowlist("foo", "requestId"),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"foo":       "bar",
+			"requestId": "42",
+			"email":     "jane@example.com",
+			"labels":    map[string]string{"tier": "frontend"},
+			"httpRequest": map[string]interface{}{
+				"requestMethod": "GET",
+			},
+			fieldNameTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"foo":       "bar",
+		"requestId": "42",
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+	if want := "4bf92f3577b34da6a3ce929d0e0e4736"; got["logging.googleapis.com/trace"] != want {
+		t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], want)
+	}
+	if want := map[string]interface{}{"tier": "frontend"}; !reflect.DeepEqual(got["logging.googleapis.com/labels"], want) {
+		t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(want))
+	}
+	if want := map[string]interface{}{"requestMethod": "GET"}; !reflect.DeepEqual(got["httpRequest"], want) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(want))
+	}
+}
+
+func TestFieldDenylist(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    interface{}
+	}{
+		{
+			name:    "denylist",
+			options: []Option{WithFieldDenylist("email")},
+			want: map[string]interface{}{
+				"foo":      "bar",
+				"password": "[REDACTED]",
+			},
+		},
+		{
+			name: "denylist and redaction",
+			options: []Option{
+				WithFieldDenylist("email", "password"),
+			},
+			want: map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+		{
+			name: "allowlist and denylist",
+			options: []Option{
+				WithFieldAllowlist("foo", "email"),
+				WithFieldDenylist("email"),
+			},
+			want: map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(append([]Option{WithRedactKeys("password")}, tt.options...)...)
+
+			logger.
+				WithFields(logrus.Fields{
+					"foo":      "bar",
+					"email":    "jane@example.com",
+					"password": "secret",
+				}).
+				Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.want) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
@@ -1,23 +1,56 @@
 package stackdriver
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-stack/stack"
 	"github.com/sirupsen/logrus"
 )
 
+// skipTimestamp suppresses the timestamp of all formatters, which keeps the
+// output of tests predictable.
+//
+// Deprecated: use WithoutTimestamp, which only affects a single formatter.
 var skipTimestamp bool
 
+var bufferPool = sync.Pool{
+	New: newBuffer,
+}
+
+func newBuffer() interface{} {
+	return new(bytes.Buffer)
+}
+
+// ansiSequence matches ANSI CSI escape sequences, e.g. color codes.
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]`)
+
 type severity string
 
+// DefaultSubjectKey and DefaultOperationIdKey are the field keys NewFormatter
+// configures unless WithSubjectKey or WithOperationIDKey are used. Changing
+// them only affects Formatters created afterwards.
 var (
-	DefaultSubjectKey     = "X-Subject-Id"
-	DefaultOperationIdKey = "X-Request-Id"
+	DefaultSubjectKey     = fieldNameSubjectID
+	DefaultOperationIdKey = fieldNameOperationID
+)
+
+// fieldNameSubjectID and fieldNameOperationID are the keys of a zero
+// Formatter, which unlike the Default variables can't be changed concurrently.
+const (
+	fieldNameSubjectID   = "X-Subject-Id"
+	fieldNameOperationID = "X-Request-Id"
 )
 
 const (
@@ -27,18 +60,95 @@ const (
 
 	fieldNameTraceID = prefixTracerState + "traceid"
 	fieldNameSpanID  = prefixTracerState + "spanid"
+	fieldNameSampled = prefixTracerState + "sampled"
+
+	fieldNameTraceSampled = "traceSampled"
+
+	// See https://www.w3.org/TR/trace-context/#traceparent-header
+	fieldNameTraceParent = "traceparent"
+
+	// See https://cloud.google.com/trace/docs/trace-context#legacy-http-header
+	fieldNameCloudTraceContext = "X-Cloud-Trace-Context"
+)
+
+const fieldNameInsertID = "insertId"
+
+const fieldNameSeverity = "severity"
+
+const fieldNameCaptureStack = "captureStack"
+
+const (
+	fieldNameAuditLog = "auditLog"
+	// auditLogType is the type URL of audit logs in the protoPayload.
+	auditLogType = "type.googleapis.com/google.cloud.audit.AuditLog"
+)
+
+const (
+	fieldNameServiceName    = "serviceName"
+	fieldNameServiceVersion = "serviceVersion"
+)
+
+const (
+	fieldNameErrorCode = "errorCode"
+	fieldNameErrorType = "errorType"
+)
+
+const (
+	// labelComponent is the label holding the component of an entry.
+	labelComponent = "component"
+	// labelSequence is the label holding the sequence number of an entry.
+	labelSequence = "sequence"
+	// labelBuildCommit and labelBuildTime are the labels holding the build
+	// info of a service.
+	labelBuildCommit = "build_commit"
+	labelBuildTime   = "build_time"
+)
+
+const (
+	fieldNameOperationProducer = "operationProducer"
+	fieldNameOperationFirst    = "operationFirst"
+	fieldNameOperationLast     = "operationLast"
 )
 
 const (
-	severityDebug    severity = "DEBUG"
-	severityInfo     severity = "INFO"
-	severityWarning  severity = "WARNING"
-	severityError    severity = "ERROR"
-	severityCritical severity = "CRITICAL"
-	severityAlert    severity = "ALERT"
+	severityDefault   severity = "DEFAULT"
+	severityDebug     severity = "DEBUG"
+	severityInfo      severity = "INFO"
+	severityNotice    severity = "NOTICE"
+	severityWarning   severity = "WARNING"
+	severityError     severity = "ERROR"
+	severityCritical  severity = "CRITICAL"
+	severityAlert     severity = "ALERT"
+	severityEmergency severity = "EMERGENCY"
 )
 
+func (s severity) isError() bool {
+	switch s {
+	case severityError, severityCritical, severityAlert, severityEmergency:
+		return true
+	}
+	return false
+}
+
+var knownSeverities = map[severity]bool{
+	severityDefault:   true,
+	severityDebug:     true,
+	severityInfo:      true,
+	severityNotice:    true,
+	severityWarning:   true,
+	severityError:     true,
+	severityCritical:  true,
+	severityAlert:     true,
+	severityEmergency: true,
+}
+
+// parseSeverity returns the severity named s, if it is known.
+func parseSeverity(s string) (severity, bool) {
+	return severity(s), knownSeverities[severity(s)]
+}
+
 var levelsToSeverity = map[logrus.Level]severity{
+	logrus.TraceLevel: severityDebug,
 	logrus.DebugLevel: severityDebug,
 	logrus.InfoLevel:  severityInfo,
 	logrus.WarnLevel:  severityWarning,
@@ -71,30 +181,135 @@ type sourceLocation struct {
 	Function string `json:"function,omitempty"`
 }
 
-type context struct {
-	Data           map[string]interface{} `json:"data,omitempty"`
-	ReportLocation *reportLocation        `json:"reportLocation,omitempty"`
-	HTTPRequest    map[string]interface{} `json:"httpRequest,omitempty"`
-	User           string                 `json:"user,omitempty"`
+// SourceReference identifies the revision of the source code the service was
+// built from, so Error Reporting can link to it.
+type SourceReference struct {
+	Repository string `json:"repository,omitempty"`
+	RevisionID string `json:"revisionId,omitempty"`
+}
+
+type errorContext struct {
+	Data             map[string]interface{} `json:"data,omitempty"`
+	ReportLocation   *reportLocation        `json:"reportLocation,omitempty"`
+	HTTPRequest      map[string]interface{} `json:"httpRequest,omitempty"`
+	User             string                 `json:"user,omitempty"`
+	SourceReferences []SourceReference      `json:"sourceReferences,omitempty"`
+	ReportLocations  []reportLocation       `json:"reportLocations,omitempty"`
+}
+
+type monitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (c *errorContext) empty() bool {
+	return len(c.Data) == 0 && c.ReportLocation == nil && len(c.HTTPRequest) == 0 && c.User == "" && len(c.SourceReferences) == 0 && len(c.ReportLocations) == 0
+}
+
+type timestamp struct {
+	Seconds int64 `json:"seconds"`
+	Nanos   int32 `json:"nanos"`
 }
 
 type entry struct {
-	Timestamp      string          `json:"timestamp,omitempty"`
-	ServiceContext *serviceContext `json:"serviceContext,omitempty"`
-	Message        string          `json:"message,omitempty"`
-	Severity       severity        `json:"severity,omitempty"`
-	Context        *context        `json:"context,omitempty"`
-	Trace          string          `json:"logging.googleapis.com/trace,omitempty"`
-	SpanID         string          `json:"logging.googleapis.com/span_id,omitempty"`
-	SourceLocation *sourceLocation `json:"sourceLocation,omitempty"`
-	Operation      *operation      `json:"operation,omitempty"`
+	Timestamp      interface{}            `json:"timestamp,omitempty"`
+	ServiceContext *serviceContext        `json:"serviceContext,omitempty"`
+	Message        string                 `json:"message,omitempty"`
+	Severity       severity               `json:"severity,omitempty"`
+	Context        *errorContext          `json:"context,omitempty"`
+	Trace          string                 `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID         string                 `json:"logging.googleapis.com/span_id,omitempty"`
+	TraceSampled   bool                   `json:"logging.googleapis.com/trace_sampled,omitempty"`
+	InsertID       string                 `json:"logging.googleapis.com/insertId,omitempty"`
+	HTTPRequest    map[string]interface{} `json:"httpRequest,omitempty"`
+	Labels         map[string]string      `json:"logging.googleapis.com/labels,omitempty"`
+	SourceLocation *sourceLocation        `json:"sourceLocation,omitempty"`
+	Operation      *operation             `json:"operation,omitempty"`
+	Resource       *monitoredResource     `json:"resource,omitempty"`
+	ProtoPayload   map[string]interface{} `json:"protoPayload,omitempty"`
+
+	// Payload holds fields serialized at the top level of the entry.
+	Payload map[string]interface{} `json:"-"`
 }
 
 // Formatter implements Stackdriver formatting for logrus.
 type Formatter struct {
-	Service   string
-	Version   string
-	StackSkip []string
+	Service         string
+	Version         string
+	BuildCommit     string
+	BuildTime       string
+	StackSkip       []string
+	StackSkipPrefix []string
+	StackSkipRegexp []*regexp.Regexp
+	CallerSkip      int
+	TrimPathPrefix  string
+	Clock           func() time.Time
+	TimestampFormat string
+	ProtoTimestamp  bool
+	ExtraTimeKey    string
+	NoTimestamp     bool
+	Labels          map[string]string
+	LabelPrefix     string
+	LabelKeyCase    LabelKeyCase
+	Component       string
+	ProjectID       string
+	ResourceType    string
+	ResourceLabels  map[string]string
+	SeverityMap     map[logrus.Level]string
+	DefaultSeverity string
+	MinLevel        logrus.Level
+	FilterLevels    bool
+	StackTrace      bool
+	StackField      string
+	MultiFrameDepth int
+	RedactKeys      []string
+	FieldAllowlist  []string
+	FieldDenylist   []string
+
+	RedactValuePatterns   []RedactPattern
+	DisableSourceLocation bool
+	AlwaysServiceContext  bool
+
+	SubjectKey     string
+	UserKey        string
+	SeverityKey    string
+	LevelKey       string
+	ErrorKey       string
+	RemoteIPKey    string
+	OperationIDKey string
+	TraceIDKey     string
+	SpanIDKey      string
+
+	CloudTraceContextKey string
+
+	OperationProducer string
+	NormalizeTraceID  bool
+
+	FlatPayload         bool
+	AuditLog            bool
+	ReservedKeyPrefix   string
+	FieldKeyMap         map[string]string
+	Pretty              bool
+	TextPayloadForPlain bool
+	Marshaler           func(interface{}) ([]byte, error)
+	KeepErrorField      bool
+	StripANSI           bool
+	MaxEntryBytes       int
+	MaxDepth            int
+	DurationUnit        time.Duration
+
+	SourceReferences []SourceReference
+
+	DowngradeErrors []func(error) bool
+
+	SpanContextExtractor func(context.Context) (traceID, spanID string, sampled bool)
+	InsertIDGenerator    func() string
+	ContextExtractor     func(context.Context) logrus.Fields
+	ValueEncoder         func(key string, v interface{}) (interface{}, bool)
+
+	serviceContext *serviceContext
+	sequence       *uint64
+	skipCache      *sync.Map
 }
 
 // Option lets you configure the Formatter.
@@ -114,6 +329,16 @@ func WithVersion(v string) Option {
 	}
 }
 
+// WithBuildInfo lets you configure the commit and build time of a service,
+// which are attached to every entry as the "build_commit" and "build_time"
+// labels. The version remains what Error Reporting groups errors by.
+func WithBuildInfo(commit, buildTime string) Option {
+	return func(f *Formatter) {
+		f.BuildCommit = commit
+		f.BuildTime = buildTime
+	}
+}
+
 // WithStackSkip lets you configure which packages should be skipped for locating the error.
 func WithStackSkip(v string) Option {
 	return func(f *Formatter) {
@@ -121,148 +346,1470 @@ func WithStackSkip(v string) Option {
 	}
 }
 
-// NewFormatter returns a new Formatter.
-func NewFormatter(options ...Option) *Formatter {
-	fmtr := Formatter{
-		StackSkip: []string{
-			"github.com/sirupsen/logrus",
-		},
-	}
-	for _, option := range options {
-		option(&fmtr)
+// WithStackSkipPrefix lets you configure a package path prefix, all packages
+// matching it are skipped for locating the error.
+func WithStackSkipPrefix(prefix string) Option {
+	return func(f *Formatter) {
+		f.StackSkipPrefix = append(f.StackSkipPrefix, prefix)
 	}
-	return &fmtr
 }
 
-func (f *Formatter) errorOrigin() (stack.Call, error) {
-	skip := func(pkg string) bool {
-		for _, skip := range f.StackSkip {
-			if pkg == skip {
-				return true
-			}
+// WithStackSkipRegexp lets you configure a regular expression, all packages
+// whose path it matches are skipped for locating the error.
+func WithStackSkipRegexp(re *regexp.Regexp) Option {
+	return func(f *Formatter) {
+		if re != nil {
+			f.StackSkipRegexp = append(f.StackSkipRegexp, re)
 		}
-		return false
 	}
+}
 
-	// We start at 2 to skip this call and our caller's call.
-	for i := 2; ; i++ {
-		c := stack.Caller(i)
-		// ErrNoFunc indicates we're over traversing the stack.
-		if _, err := c.MarshalText(); err != nil {
-			return stack.Call{}, nil
-		}
-		pkg := fmt.Sprintf("%+k", c)
-		// Remove vendoring from package path.
-		parts := strings.SplitN(pkg, "/vendor/", 2)
-		pkg = parts[len(parts)-1]
-		if !skip(pkg) {
-			return c, nil
+// WithCallerSkip lets you configure the number of frames to skip above the
+// caller of logrus, e.g. 1 if entries are logged through a helper function.
+func WithCallerSkip(n int) Option {
+	return func(f *Formatter) {
+		if n > 0 {
+			f.CallerSkip = n
 		}
 	}
 }
 
-// Format formats a logrus entry according to the Stackdriver specifications.
-func (f *Formatter) Format(e *logrus.Entry) ([]byte, error) {
-	severity := levelsToSeverity[e.Level]
+// WithTrimPathPrefix lets you configure a prefix, which is removed from the
+// file paths of source and report locations, e.g. the module path.
+func WithTrimPathPrefix(prefix string) Option {
+	return func(f *Formatter) {
+		f.TrimPathPrefix = prefix
+	}
+}
 
-	ee := entry{
+// WithClock lets you configure the clock used to timestamp entries.
+func WithClock(c func() time.Time) Option {
+	return func(f *Formatter) {
+		f.Clock = c
+	}
+}
 
-		Message:  e.Message,
-		Severity: severity,
-		Context: &context{
-			Data: e.Data,
-		},
+// WithTimestampFormat lets you configure the layout used to format timestamps.
+func WithTimestampFormat(layout string) Option {
+	return func(f *Formatter) {
+		f.TimestampFormat = layout
 	}
+}
 
-	if !skipTimestamp {
-		ee.Timestamp = time.Now().UTC().Format(time.RFC3339)
+// WithProtoTimestamp lets you configure the formatter to emit timestamps as
+// seconds and nanos instead of a formatted string.
+func WithProtoTimestamp() Option {
+	return func(f *Formatter) {
+		f.ProtoTimestamp = true
 	}
+}
 
-	switch severity {
-	case severityError, severityCritical, severityAlert:
-		ee.ServiceContext = &serviceContext{
-			Service: f.Service,
-			Version: f.Version,
-		}
+// WithoutTimestamp lets you configure the formatter to omit the timestamp of
+// entries, which Cloud Logging then sets on receipt.
+func WithoutTimestamp() Option {
+	return func(f *Formatter) {
+		f.NoTimestamp = true
+	}
+}
 
-		// When using WithError(), the error is sent separately, but Error
-		// Reporting expects it to be a part of the message so we append it
-		// instead.
-		if err, ok := ee.Context.Data["error"]; ok {
-			ee.Message = fmt.Sprintf("%s: %s", e.Message, err)
-			delete(ee.Context.Data, "error")
-		} else {
-			ee.Message = e.Message
+// WithExtraTimeKey lets you configure an additional key the timestamp is
+// written to, e.g. "@timestamp" for pipelines indexing on it. Keys of the
+// entry itself, e.g. "timestamp", are ignored, and a field of the same name
+// in a flat payload takes precedence.
+func WithExtraTimeKey(key string) Option {
+	return func(f *Formatter) {
+		if reservedKeys[key] {
+			return
 		}
+		f.ExtraTimeKey = key
+	}
+}
 
-		// As a convenience, when using supplying the httpRequest field, it
-		// gets special care.
-		if reqData, ok := ee.Context.Data["httpRequest"]; ok {
-			if req, ok := reqData.(map[string]interface{}); ok {
-				ee.Context.HTTPRequest = req
-				delete(ee.Context.Data, "httpRequest")
-			}
+// WithLabels lets you configure labels attached to every entry.
+func WithLabels(labels map[string]string) Option {
+	return func(f *Formatter) {
+		if f.Labels == nil {
+			f.Labels = make(map[string]string, len(labels))
 		}
-
-		// If we find a user/subject id in the log fields, add it to the error context
-		if user := getStringValue(DefaultSubjectKey, ee.Context.Data); user != "" {
-			ee.Context.User = user
-			delete(ee.Context.Data, DefaultSubjectKey)
+		for k, v := range labels {
+			f.Labels[k] = v
 		}
+	}
+}
+
+// WithLabelPrefix lets you configure a prefix marking log fields as labels,
+// e.g. with the prefix "label." the field "label.region" becomes the label
+// "region".
+func WithLabelPrefix(prefix string) Option {
+	return func(f *Formatter) {
+		f.LabelPrefix = prefix
+	}
+}
 
-		// Extract report location from call stack.
-		if c, err := f.errorOrigin(); err == nil {
-			lineNumber, _ := strconv.ParseInt(fmt.Sprintf("%d", c), 10, 64)
+// WithComponent lets you configure the component of a service, which is
+// attached to every entry as the "component" label. This allows to tell
+// apart the entries of binaries hosting several components.
+func WithComponent(name string) Option {
+	return func(f *Formatter) {
+		f.Component = name
+	}
+}
 
-			ee.Context.ReportLocation = &reportLocation{
-				FilePath:     fmt.Sprintf("%+s", c),
-				LineNumber:   int(lineNumber),
-				FunctionName: fmt.Sprintf("%n", c),
-			}
+// WithProjectID lets you configure the project id used to qualify trace ids,
+// which is required for Cloud Logging to correlate entries with Cloud Trace.
+func WithProjectID(projectID string) Option {
+	return func(f *Formatter) {
+		f.ProjectID = projectID
+	}
+}
+
+// WithSpanContextExtractor lets you configure how trace information is
+// extracted from the context.Context attached to an entry, e.g. from an
+// OpenTelemetry span. It is only consulted if no trace was found in the fields.
+func WithSpanContextExtractor(fn func(context.Context) (traceID, spanID string, sampled bool)) Option {
+	return func(f *Formatter) {
+		f.SpanContextExtractor = fn
+	}
+}
+
+// WithInsertIDGenerator lets you configure how insert ids are generated for
+// entries that don't carry one. Cloud Logging orders entries with the same
+// timestamp by insert id, so generated ids should increase monotonically.
+func WithInsertIDGenerator(fn func() string) Option {
+	return func(f *Formatter) {
+		f.InsertIDGenerator = fn
+	}
+}
+
+// WithContextExtractor lets you configure a function that extracts fields
+// from the context.Context attached to an entry, e.g. a tenant or user id.
+// The extracted fields are treated like fields added with WithField, but
+// fields set explicitly on the entry take precedence.
+func WithContextExtractor(fn func(context.Context) logrus.Fields) Option {
+	return func(f *Formatter) {
+		f.ContextExtractor = fn
+	}
+}
+
+// WithValueEncoder lets you configure how field values are serialized. It is
+// called for every field, if it returns true, the value is replaced by the
+// returned one, e.g. to render durations as strings.
+func WithValueEncoder(fn func(key string, v interface{}) (interface{}, bool)) Option {
+	return func(f *Formatter) {
+		f.ValueEncoder = fn
+	}
+}
+
+// WithSequenceNumbers lets you configure the formatter to number entries in
+// the "sequence" label, which keeps the order of entries sharing a timestamp.
+func WithSequenceNumbers() Option {
+	return func(f *Formatter) {
+		f.sequence = new(uint64)
+	}
+}
+
+// WithMonitoredResource lets you configure the monitored resource attached to
+// every entry, e.g. "gce_instance" with its instance_id and zone labels.
+func WithMonitoredResource(resourceType string, labels map[string]string) Option {
+	return func(f *Formatter) {
+		f.ResourceType = resourceType
+		f.ResourceLabels = labels
+	}
+}
+
+// WithSeverityMap lets you override the severity used for individual levels.
+// Levels that are not in m, or map to an unknown severity, keep their default.
+func WithSeverityMap(m map[logrus.Level]string) Option {
+	return func(f *Formatter) {
+		if f.SeverityMap == nil {
+			f.SeverityMap = make(map[logrus.Level]string, len(m))
 		}
-	default:
-		// Always try to add the source location to logs, if we are not reporting an error
-		if c, err := f.errorOrigin(); err == nil {
-			lineNumber, _ := strconv.ParseInt(fmt.Sprintf("%d", c), 10, 64)
-
-			ee.SourceLocation = &sourceLocation{
-				File:     fmt.Sprintf("%+s", c),
-				Line:     fmt.Sprintf("%d", int(lineNumber)),
-				Function: fmt.Sprintf("%n", c),
+		for level, s := range m {
+			if knownSeverities[severity(s)] {
+				f.SeverityMap[level] = s
 			}
 		}
 	}
+}
 
-	if operationId := getStringValue(DefaultOperationIdKey, ee.Context.Data); operationId != "" {
-		ee.Operation = &operation{
-			Id: operationId,
+// WithMinSeverity lets you configure the least severe level the formatter
+// emits, independent of the level of the logger. Format returns no bytes for
+// less severe entries, which logrus then writes as an empty write. Note that
+// hooks are still fired for them.
+func WithMinSeverity(level logrus.Level) Option {
+	return func(f *Formatter) {
+		f.MinLevel = level
+		f.FilterLevels = true
+	}
+}
+
+// WithDefaultSeverity lets you configure the severity used for levels that
+// aren't mapped to a severity, e.g. custom levels. It defaults to "DEFAULT".
+func WithDefaultSeverity(s string) Option {
+	return func(f *Formatter) {
+		if knownSeverities[severity(s)] {
+			f.DefaultSeverity = s
 		}
-		delete(ee.Context.Data, DefaultOperationIdKey)
 	}
+}
 
-	// Add tracing information to all logs if available
-	if traceId := getStringValue(fieldNameTraceID, ee.Context.Data); traceId != "" {
-		ee.Trace = traceId
-		delete(ee.Context.Data, fieldNameTraceID)
+// WithStackTrace lets you configure the formatter to append a stack trace to
+// the message of errors, which Error Reporting uses to group them.
+func WithStackTrace() Option {
+	return func(f *Formatter) {
+		f.StackTrace = true
 	}
-	if spanId := getStringValue(fieldNameSpanID, ee.Context.Data); spanId != "" {
-		ee.SpanID = spanId
-		delete(ee.Context.Data, fieldNameSpanID)
+}
+
+// WithStackField lets you configure the field, which holds the stack trace of
+// entries with a captureStack field set to true, regardless of severity.
+func WithStackField(key string) Option {
+	return func(f *Formatter) {
+		f.StackField = key
 	}
+}
 
-	b, err := json.Marshal(ee)
-	if err != nil {
-		return nil, err
+// WithoutSourceLocation lets you configure the formatter to omit the source
+// location of entries, which saves walking the stack for every entry. Errors
+// still get a report location, which Error Reporting requires.
+func WithoutSourceLocation() Option {
+	return func(f *Formatter) {
+		f.DisableSourceLocation = true
 	}
+}
 
-	return append(b, '\n'), nil
+// WithAlwaysServiceContext lets you configure the formatter to add the
+// service context to entries of all severities, not only to errors, which
+// allows to query all entries of a service version.
+func WithAlwaysServiceContext() Option {
+	return func(f *Formatter) {
+		f.AlwaysServiceContext = true
+	}
 }
 
-func getStringValue(key string, context map[string]interface{}) string {
-	if val, ok := context[key]; ok {
-		if stringVal, ok := val.(string); ok {
-			return stringVal
+// WithMultiFrameLocation lets you configure the formatter to add the
+// locations of up to depth frames to the context of errors, which helps to
+// tell apart errors originating from the same place.
+func WithMultiFrameLocation(depth int) Option {
+	return func(f *Formatter) {
+		if depth > 0 {
+			f.MultiFrameDepth = depth
 		}
 	}
-	return ""
+}
+
+// WithRedactKeys lets you configure fields whose values are replaced with
+// "[REDACTED]", e.g. passwords or authorization headers. Keys are matched case
+// insensitively, also within the httpRequest field.
+func WithRedactKeys(keys ...string) Option {
+	return func(f *Formatter) {
+		f.RedactKeys = append(f.RedactKeys, keys...)
+	}
+}
+
+// WithFieldAllowlist lets you configure the only fields, which are emitted.
+// Other fields are dropped, after the fields with a special meaning, e.g. the
+// trace or labels, have been processed.
+func WithFieldAllowlist(keys ...string) Option {
+	return func(f *Formatter) {
+		f.FieldAllowlist = append(f.FieldAllowlist, keys...)
+	}
+}
+
+// WithFieldDenylist lets you configure fields, which are dropped, after the
+// fields with a special meaning have been processed. Unlike redacted fields,
+// they're removed entirely. Along with an allowlist, fields in both lists are
+// dropped.
+func WithFieldDenylist(keys ...string) Option {
+	return func(f *Formatter) {
+		f.FieldDenylist = append(f.FieldDenylist, keys...)
+	}
+}
+
+// WithRedactValuePattern lets you configure a pattern whose matches in string
+// values are replaced with replacement, regardless of the key, e.g. to scrub
+// bearer tokens. Nested maps and slices are searched as well.
+func WithRedactValuePattern(re *regexp.Regexp, replacement string) Option {
+	return func(f *Formatter) {
+		f.RedactValuePatterns = append(f.RedactValuePatterns, RedactPattern{
+			Regexp:      re,
+			Replacement: replacement,
+		})
+	}
+}
+
+// WithSubjectKey lets you configure the field holding the subject id, which
+// defaults to DefaultSubjectKey.
+func WithSubjectKey(key string) Option {
+	return func(f *Formatter) {
+		f.SubjectKey = key
+	}
+}
+
+// WithUserKey lets you configure a field holding the user of errors,
+// independent of the subject key. If both fields are present, the user field
+// is used and the subject is kept as regular data.
+func WithUserKey(key string) Option {
+	return func(f *Formatter) {
+		f.UserKey = key
+	}
+}
+
+// WithSeverityKey lets you configure the field overriding the severity of an
+// entry, which defaults to "severity". Fields not holding a valid severity
+// are kept as regular data.
+func WithSeverityKey(key string) Option {
+	return func(f *Formatter) {
+		f.SeverityKey = key
+	}
+}
+
+// WithDowngradeErrors lets you configure matchers for expected errors, e.g.
+// errors.Is(err, context.Canceled). Entries of error severity whose error
+// field matches are emitted as warnings without the error context, so they
+// don't show up in Error Reporting.
+func WithDowngradeErrors(matchers ...func(error) bool) Option {
+	return func(f *Formatter) {
+		f.DowngradeErrors = append(f.DowngradeErrors, matchers...)
+	}
+}
+
+// WithErrorFieldKey lets you configure the field holding the error, which is
+// appended to the message of errors. It defaults to logrus.ErrorKey, the
+// field set by WithError.
+func WithErrorFieldKey(key string) Option {
+	return func(f *Formatter) {
+		f.ErrorKey = key
+	}
+}
+
+// WithRemoteIPKey lets you configure a field holding the client IP, which is
+// moved into the remoteIp of the httpRequest field, unless it has one already.
+func WithRemoteIPKey(key string) Option {
+	return func(f *Formatter) {
+		f.RemoteIPKey = key
+	}
+}
+
+// WithLevelField lets you configure the formatter to keep the logrus level,
+// e.g. "warning", in the given field next to the severity, for tools relying
+// on the level names.
+func WithLevelField(key string) Option {
+	return func(f *Formatter) {
+		f.LevelKey = key
+	}
+}
+
+// WithOperationIDKey lets you configure the field holding the operation id,
+// which defaults to DefaultOperationIdKey.
+func WithOperationIDKey(key string) Option {
+	return func(f *Formatter) {
+		f.OperationIDKey = key
+	}
+}
+
+// WithNormalizeTraceID lets you configure the formatter to convert numeric
+// trace ids, as emitted by some tracers, into the 32 hex characters expected
+// by Cloud Trace.
+func WithNormalizeTraceID() Option {
+	return func(f *Formatter) {
+		f.NormalizeTraceID = true
+	}
+}
+
+// WithOperationProducer lets you configure the producer of operations, e.g.
+// the name of the service. It is used for entries with an operation id that
+// don't specify a producer themselves.
+func WithOperationProducer(name string) Option {
+	return func(f *Formatter) {
+		f.OperationProducer = name
+	}
+}
+
+// WithTraceIDKey lets you configure the field holding the trace id, which
+// defaults to the OpenTracing "ot-tracer-traceid".
+func WithTraceIDKey(key string) Option {
+	return func(f *Formatter) {
+		f.TraceIDKey = key
+	}
+}
+
+// WithSpanIDKey lets you configure the field holding the span id, which
+// defaults to the OpenTracing "ot-tracer-spanid".
+func WithSpanIDKey(key string) Option {
+	return func(f *Formatter) {
+		f.SpanIDKey = key
+	}
+}
+
+// WithCloudTraceContextKey lets you configure the field holding the value of
+// the X-Cloud-Trace-Context header, which defaults to "X-Cloud-Trace-Context".
+func WithCloudTraceContextKey(key string) Option {
+	return func(f *Formatter) {
+		f.CloudTraceContextKey = key
+	}
+}
+
+// WithFlatPayload lets you configure the formatter to emit the fields of
+// non-error entries at the top level instead of under context.data, which
+// makes them easier to query.
+func WithFlatPayload() Option {
+	return func(f *Formatter) {
+		f.FlatPayload = true
+	}
+}
+
+// WithAuditLog lets you configure the formatter to emit the auditLog field as
+// the protoPayload of an entry, annotated as a google.cloud.audit.AuditLog,
+// for audit log sinks.
+func WithAuditLog() Option {
+	return func(f *Formatter) {
+		f.AuditLog = true
+	}
+}
+
+// WithFieldKeyMap lets you rename the top level keys of entries, e.g. from
+// "message" to "msg", to match existing dashboards. Keys that aren't in m are
+// kept as they are.
+func WithFieldKeyMap(m map[string]string) Option {
+	return func(f *Formatter) {
+		if f.FieldKeyMap == nil {
+			f.FieldKeyMap = make(map[string]string, len(m))
+		}
+		for k, v := range m {
+			if v != "" {
+				f.FieldKeyMap[k] = v
+			}
+		}
+	}
+}
+
+// WithPretty lets you configure the formatter to indent entries, which makes
+// them readable during local development.
+func WithPretty() Option {
+	return func(f *Formatter) {
+		f.Pretty = true
+	}
+}
+
+// WithTextPayloadForPlain lets you configure the formatter to emit entries
+// without fields as plain text, which Cloud Logging stores as a cheaper
+// textPayload. Note that their severity, timestamp and source location are
+// lost then, the logging agent assigns a severity itself. Errors, multi-line
+// messages and entries with a service context or monitored resource are
+// always emitted as JSON.
+func WithTextPayloadForPlain() Option {
+	return func(f *Formatter) {
+		f.TextPayloadForPlain = true
+	}
+}
+
+// WithReservedKeyPrefix lets you configure the prefix of fields colliding
+// with the entry's own keys, e.g. "severity". It defaults to "field.".
+func WithReservedKeyPrefix(prefix string) Option {
+	return func(f *Formatter) {
+		if prefix != "" {
+			f.ReservedKeyPrefix = prefix
+		}
+	}
+}
+
+// WithKeepErrorField lets you keep the error in the data of the error context,
+// in addition to appending it to the message. This allows to query for it or
+// use it in log-based metrics. Joined errors are additionally kept as a list
+// in the "errors" field.
+func WithKeepErrorField() Option {
+	return func(f *Formatter) {
+		f.KeepErrorField = true
+	}
+}
+
+// WithStripANSI lets you configure the formatter to remove ANSI escape
+// sequences, e.g. color codes, from messages.
+func WithStripANSI() Option {
+	return func(f *Formatter) {
+		f.StripANSI = true
+	}
+}
+
+// WithDurationUnit lets you configure the formatter to emit time.Duration
+// fields as a number of the given unit, e.g. time.Second, rather than as
+// nanoseconds, which log-based distribution metrics can extract.
+func WithDurationUnit(unit time.Duration) Option {
+	return func(f *Formatter) {
+		if unit > 0 {
+			f.DurationUnit = unit
+		}
+	}
+}
+
+// WithMaxDepth lets you configure how deep maps and slices may be nested in
+// fields. Deeper ones are replaced by "[truncated]".
+func WithMaxDepth(n int) Option {
+	return func(f *Formatter) {
+		if n > 0 {
+			f.MaxDepth = n
+		}
+	}
+}
+
+// WithMaxEntryBytes lets you configure the maximum size of an entry. If an
+// entry exceeds it, its fields are replaced by a "_truncated" marker.
+func WithMaxEntryBytes(n int) Option {
+	return func(f *Formatter) {
+		if n > 0 {
+			f.MaxEntryBytes = n
+		}
+	}
+}
+
+// WithSourceReference lets you configure the repository and revision the
+// service was built from. Error Reporting uses them to link to the source.
+func WithSourceReference(repository, revisionID string) Option {
+	return func(f *Formatter) {
+		f.SourceReferences = append(f.SourceReferences, SourceReference{
+			Repository: repository,
+			RevisionID: revisionID,
+		})
+	}
+}
+
+// WithMarshaler lets you configure the function used to marshal entries to
+// JSON, e.g. to use a faster drop-in replacement for encoding/json, which is
+// used by default.
+func WithMarshaler(marshal func(interface{}) ([]byte, error)) Option {
+	return func(f *Formatter) {
+		f.Marshaler = marshal
+	}
+}
+
+// NewFormatter returns a new Formatter.
+func NewFormatter(options ...Option) *Formatter {
+	fmtr := Formatter{
+		StackSkip: []string{
+			"github.com/sirupsen/logrus",
+		},
+		Clock:           time.Now,
+		TimestampFormat: time.RFC3339Nano,
+		SubjectKey:      DefaultSubjectKey,
+		OperationIDKey:  DefaultOperationIdKey,
+		TraceIDKey:      fieldNameTraceID,
+		SpanIDKey:       fieldNameSpanID,
+		SeverityKey:     fieldNameSeverity,
+		ErrorKey:        logrus.ErrorKey,
+
+		CloudTraceContextKey: fieldNameCloudTraceContext,
+
+		skipCache: new(sync.Map),
+	}
+	for _, option := range options {
+		option(&fmtr)
+	}
+	fmtr.serviceContext = fmtr.newServiceContext()
+	return &fmtr
+}
+
+// With returns a copy of the Formatter with options applied, e.g. to derive a
+// formatter for a request with additional labels. The Formatter itself is not
+// modified. Sequence numbers are shared with the copy.
+func (f *Formatter) With(options ...Option) *Formatter {
+	fmtr := *f
+	fmtr.StackSkip = append([]string(nil), f.StackSkip...)
+	fmtr.StackSkipPrefix = append([]string(nil), f.StackSkipPrefix...)
+	fmtr.StackSkipRegexp = append([]*regexp.Regexp(nil), f.StackSkipRegexp...)
+	fmtr.RedactKeys = append([]string(nil), f.RedactKeys...)
+	fmtr.FieldAllowlist = append([]string(nil), f.FieldAllowlist...)
+	fmtr.FieldDenylist = append([]string(nil), f.FieldDenylist...)
+	fmtr.RedactValuePatterns = append([]RedactPattern(nil), f.RedactValuePatterns...)
+	fmtr.SourceReferences = append([]SourceReference(nil), f.SourceReferences...)
+	fmtr.DowngradeErrors = append([]func(error) bool(nil), f.DowngradeErrors...)
+	fmtr.Labels = copyStringMap(f.Labels)
+	fmtr.ResourceLabels = copyStringMap(f.ResourceLabels)
+	fmtr.FieldKeyMap = copyStringMap(f.FieldKeyMap)
+	if f.SeverityMap != nil {
+		fmtr.SeverityMap = make(map[logrus.Level]string, len(f.SeverityMap))
+		for level, s := range f.SeverityMap {
+			fmtr.SeverityMap[level] = s
+		}
+	}
+
+	for _, option := range options {
+		option(&fmtr)
+	}
+	fmtr.serviceContext = fmtr.newServiceContext()
+	// The skipped packages may have changed.
+	fmtr.skipCache = new(sync.Map)
+	return &fmtr
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// newServiceContext returns the service context for error entries, or nil if
+// neither service nor version are configured.
+func (f *Formatter) newServiceContext() *serviceContext {
+	if f.Service == "" && f.Version == "" {
+		return nil
+	}
+	return &serviceContext{
+		Service: f.Service,
+		Version: f.Version,
+	}
+}
+
+// getServiceContext returns the service context computed by NewFormatter,
+// unless Service or Version were changed since.
+func (f *Formatter) getServiceContext() *serviceContext {
+	if sc := f.serviceContext; sc != nil && sc.Service == f.Service && sc.Version == f.Version {
+		return sc
+	}
+	return f.newServiceContext()
+}
+
+// downgrade reports whether err matches any of the DowngradeErrors.
+func (f *Formatter) downgrade(err error) bool {
+	for _, match := range f.DowngradeErrors {
+		if match(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryServiceContext returns the service context of an entry. Processes
+// logging on behalf of several services may override the service and version
+// per entry with the serviceName and serviceVersion fields.
+func (f *Formatter) entryServiceContext(data map[string]interface{}) *serviceContext {
+	service := getStringValue(fieldNameServiceName, data)
+	version := getStringValue(fieldNameServiceVersion, data)
+	if service == "" && version == "" {
+		return f.getServiceContext()
+	}
+	delete(data, fieldNameServiceName)
+	delete(data, fieldNameServiceVersion)
+
+	return &serviceContext{
+		Service: orDefault(service, f.Service),
+		Version: orDefault(version, f.Version),
+	}
+}
+
+// skip reports whether c is in a package which is skipped for locating the
+// error. Decisions are cached by program counter, if the Formatter was
+// created by NewFormatter.
+func (f *Formatter) skip(c stack.Call) bool {
+	if f.skipCache == nil {
+		return f.skipPackage(c)
+	}
+	pc := c.Frame().PC
+	if skip, ok := f.skipCache.Load(pc); ok {
+		return skip.(bool)
+	}
+	skip := f.skipPackage(c)
+	f.skipCache.Store(pc, skip)
+	return skip
+}
+
+func (f *Formatter) skipPackage(c stack.Call) bool {
+	return f.skipPackagePath(fmt.Sprintf("%+k", c))
+}
+
+// skipFrame reports whether frame, e.g. the caller reported by logrus, is in
+// a skipped package.
+func (f *Formatter) skipFrame(frame runtime.Frame) bool {
+	pkg := frame.Function
+	// The package path ends at the first dot after the last slash.
+	i := strings.LastIndexByte(pkg, '/') + 1
+	if j := strings.IndexByte(pkg[i:], '.'); j != -1 {
+		pkg = pkg[:i+j]
+	}
+	return f.skipPackagePath(pkg)
+}
+
+func (f *Formatter) skipPackagePath(pkg string) bool {
+	// Remove vendoring from package path.
+	parts := strings.SplitN(pkg, "/vendor/", 2)
+	pkg = parts[len(parts)-1]
+	for _, skip := range f.StackSkip {
+		if pkg == skip {
+			return true
+		}
+	}
+	for _, prefix := range f.StackSkipPrefix {
+		if strings.HasPrefix(pkg, prefix) {
+			return true
+		}
+	}
+	for _, re := range f.StackSkipRegexp {
+		if re.MatchString(pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// errNoOrigin is returned by errorOrigin if all frames of the stack are
+// skipped.
+var errNoOrigin = errors.New("stackdriver: no origin found on the stack")
+
+func (f *Formatter) errorOrigin() (stack.Call, error) {
+	// We start at 2 to skip this call and our caller's call.
+	for i := 2; ; i++ {
+		c := stack.Caller(i)
+		// ErrNoFunc indicates we're over traversing the stack.
+		if _, err := c.MarshalText(); err != nil {
+			return stack.Call{}, errNoOrigin
+		}
+		if f.skip(c) {
+			continue
+		}
+		if f.CallerSkip == 0 {
+			return c, nil
+		}
+
+		// Frames of helpers wrapping logrus are skipped above the first
+		// frame outside of the skipped packages.
+		c = stack.Caller(i + f.CallerSkip)
+		if _, err := c.MarshalText(); err != nil {
+			return stack.Call{}, errNoOrigin
+		}
+		return c, nil
+	}
+}
+
+// callerFrom returns the first frame outside of the skipped packages and
+// pkgs, starting skip frames above the function calling it, plus CallerSkip
+// frames. It resolves the caller for entries formatted outside of logrus,
+// where walking the stack from Format would locate this package.
+func (f *Formatter) callerFrom(skip int, pkgs ...string) (runtime.Frame, bool) {
+	for i := skip + 1; ; i++ {
+		c := stack.Caller(i)
+		if _, err := c.MarshalText(); err != nil {
+			return runtime.Frame{}, false
+		}
+		if f.skip(c) || contains(pkgs, fmt.Sprintf("%+k", c)) {
+			continue
+		}
+		if f.CallerSkip > 0 {
+			c = stack.Caller(i + f.CallerSkip)
+			if _, err := c.MarshalText(); err != nil {
+				return runtime.Frame{}, false
+			}
+		}
+		return c.Frame(), true
+	}
+}
+
+// stackTrace renders frames the way runtime/debug.Stack does, which is what
+// Error Reporting expects. Without frames, the stack of the calling goroutine
+// is rendered.
+func (f *Formatter) stackTrace(frames []runtime.Frame) string {
+	buf := make([]byte, 64)
+	header := string(buf[:runtime.Stack(buf, false)])
+	if i := strings.IndexByte(header, '\n'); i != -1 {
+		header = header[:i]
+	}
+
+	if frames == nil {
+		// We start at 2 to skip this call and our caller's call.
+		calls := stack.Trace().TrimRuntime()
+		if len(calls) > 2 {
+			calls = calls[2:]
+		}
+		for len(calls) > 0 && f.skip(calls[0]) {
+			calls = calls[1:]
+		}
+		for _, c := range calls {
+			frames = append(frames, c.Frame())
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteByte('\n')
+	for _, frame := range frames {
+		fmt.Fprintf(&b, "%s(...)\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+	return b.String()
+}
+
+// reportLocations returns the locations of up to depth frames. Without frames,
+// the frames of the calling goroutine, which aren't skipped, are used.
+func (f *Formatter) reportLocations(frames []runtime.Frame, depth int) []reportLocation {
+	if frames == nil {
+		// We start at 2 to skip this call and our caller's call.
+		calls := stack.Trace().TrimRuntime()
+		if len(calls) > 2 {
+			calls = calls[2:]
+		}
+		for _, c := range calls {
+			if len(frames) == depth {
+				break
+			}
+			if !f.skip(c) {
+				frames = append(frames, c.Frame())
+			}
+		}
+	}
+	if len(frames) > depth {
+		frames = frames[:depth]
+	}
+
+	locations := make([]reportLocation, 0, len(frames))
+	for _, frame := range frames {
+		file, function := frameLocation(frame)
+		locations = append(locations, reportLocation{
+			FilePath:     file,
+			LineNumber:   frame.Line,
+			FunctionName: function,
+		})
+	}
+	return locations
+}
+
+// SeverityFor returns the severity entries of level are emitted with, taking
+// the severity map and default severity into account. Severity fields of
+// individual entries aren't considered.
+func (f *Formatter) SeverityFor(level logrus.Level) string {
+	return string(f.severity(level))
+}
+
+func (f *Formatter) severity(level logrus.Level) severity {
+	if s, ok := f.SeverityMap[level]; ok && knownSeverities[severity(s)] {
+		return severity(s)
+	}
+	if s, ok := levelsToSeverity[level]; ok {
+		return s
+	}
+	if f.DefaultSeverity != "" {
+		return severity(f.DefaultSeverity)
+	}
+	return severityDefault
+}
+
+func (f *Formatter) now() time.Time {
+	if f.Clock == nil {
+		return time.Now()
+	}
+	return f.Clock()
+}
+
+// Format formats a logrus entry according to the Stackdriver specifications.
+func (f *Formatter) Format(e *logrus.Entry) ([]byte, error) {
+	if f.FilterLevels && e.Level > f.MinLevel {
+		return nil, nil
+	}
+
+	severity := f.severity(e.Level)
+
+	// Entries may be constructed without fields, the reserved fields are
+	// extracted from and written to a map though.
+	data := e.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	ee := entry{
+		Message:  e.Message,
+		Severity: severity,
+		Context: &errorContext{
+			Data: data,
+		},
+	}
+
+	if e.Context != nil && f.ContextExtractor != nil {
+		for k, v := range f.ContextExtractor(e.Context) {
+			if _, ok := ee.Context.Data[k]; ok {
+				continue
+			}
+			ee.Context.Data[k] = v
+		}
+	}
+
+	f.redact(ee.Context.Data)
+
+	// The severity field allows to override the severity derived from the
+	// level, e.g. to emit a NOTICE.
+	severityKey := orDefault(f.SeverityKey, fieldNameSeverity)
+	if s, ok := parseSeverity(getStringValue(severityKey, ee.Context.Data)); ok {
+		severity = s
+		ee.Severity = s
+		delete(ee.Context.Data, severityKey)
+	}
+
+	if f.LevelKey != "" {
+		ee.Context.Data[f.LevelKey] = e.Level.String()
+	}
+
+	// Entries may ask for the stack of the goroutine, e.g. to debug a
+	// warning without reporting an error.
+	if f.StackField != "" {
+		if capture, ok := getBoolValue(fieldNameCaptureStack, ee.Context.Data); ok {
+			if capture {
+				ee.Context.Data[f.StackField] = f.stackTrace(nil)
+			}
+			delete(ee.Context.Data, fieldNameCaptureStack)
+		}
+	}
+
+	if !skipTimestamp && !f.NoTimestamp {
+		now := f.now().UTC()
+		if f.ProtoTimestamp {
+			ee.Timestamp = &timestamp{
+				Seconds: now.Unix(),
+				Nanos:   int32(now.Nanosecond()),
+			}
+		} else {
+			layout := f.TimestampFormat
+			if layout == "" {
+				layout = time.RFC3339Nano
+			}
+			ee.Timestamp = now.Format(layout)
+		}
+	}
+
+	// As a convenience, when using supplying the httpRequest field, it
+	// gets special care. Error Reporting expects it as part of the error
+	// context, while Cloud Logging expects it at the top level.
+	httpRequest := liftHTTPRequest(ee.Context.Data)
+	if httpRequest != nil && f.RemoteIPKey != "" {
+		if _, ok := httpRequest["remoteIp"]; !ok {
+			if ip := getStringValue(f.RemoteIPKey, ee.Context.Data); ip != "" {
+				httpRequest = withRemoteIP(httpRequest, ip)
+				delete(ee.Context.Data, f.RemoteIPKey)
+			}
+		}
+	}
+
+	if f.AuditLog {
+		ee.ProtoPayload = auditLog(ee.Context.Data)
+	}
+
+	// Expected errors, e.g. canceled requests, are logged as warnings, so
+	// they don't show up in Error Reporting.
+	errorKey := orDefault(f.ErrorKey, logrus.ErrorKey)
+	if err, ok := ee.Context.Data[errorKey].(error); ok && severity.isError() && f.downgrade(err) {
+		severity = severityWarning
+		ee.Severity = severityWarning
+		ee.Message = fmt.Sprintf("%s: %s", e.Message, err)
+		delete(ee.Context.Data, errorKey)
+	}
+
+	var frames []runtime.Frame
+	switch {
+	case severity.isError():
+		ee.ServiceContext = f.entryServiceContext(ee.Context.Data)
+
+		// When using WithError(), the error is sent separately, but Error
+		// Reporting expects it to be a part of the message so we append it
+		// instead.
+		if err, ok := ee.Context.Data[errorKey]; ok && err != nil {
+			var msg string
+			var msgs []string
+			switch err := err.(type) {
+			case error:
+				msg = err.Error()
+				msgs = joinedErrors(err)
+
+				// Errors which carry their own stack trace tell us where they
+				// originated, which is more useful than where they were logged.
+				frames = errorStack(err)
+
+				// Codes and types of errors are kept structured, unless
+				// they were passed explicitly.
+				code, typ := errorDetails(err)
+				if _, ok := ee.Context.Data[fieldNameErrorCode]; !ok && code != "" {
+					ee.Context.Data[fieldNameErrorCode] = code
+				}
+				if _, ok := ee.Context.Data[fieldNameErrorType]; !ok && typ != "" {
+					ee.Context.Data[fieldNameErrorType] = typ
+				}
+			default:
+				msg = fmt.Sprintf("%v", err)
+			}
+
+			// Joined errors are listed one per line, so that each of them
+			// is still recognizable.
+			if len(msgs) > 0 {
+				ee.Message = e.Message + ":\n- " + strings.Join(msgs, "\n- ")
+			} else {
+				ee.Message = fmt.Sprintf("%s: %s", e.Message, msg)
+			}
+
+			if f.KeepErrorField {
+				ee.Context.Data[errorKey] = msg
+				if len(msgs) > 0 {
+					ee.Context.Data["errors"] = msgs
+				}
+			} else {
+				delete(ee.Context.Data, errorKey)
+			}
+
+			if f.StackTrace {
+				ee.Message += "\n\n" + f.stackTrace(frames)
+			}
+		} else {
+			ee.Message = e.Message
+			delete(ee.Context.Data, errorKey)
+		}
+
+		ee.Context.HTTPRequest = httpRequest
+		ee.Context.SourceReferences = f.SourceReferences
+
+		// If we find a user/subject id in the log fields, add it to the error
+		// context. A dedicated user field takes precedence over the subject.
+		subjectKey := orDefault(f.SubjectKey, fieldNameSubjectID)
+		if user := getStringValue(f.UserKey, ee.Context.Data); f.UserKey != "" && user != "" {
+			ee.Context.User = user
+			delete(ee.Context.Data, f.UserKey)
+		} else if user := getStringValue(subjectKey, ee.Context.Data); user != "" {
+			ee.Context.User = user
+			delete(ee.Context.Data, subjectKey)
+		}
+
+		if f.MultiFrameDepth > 0 {
+			ee.Context.ReportLocations = f.reportLocations(frames, f.MultiFrameDepth)
+		}
+	default:
+		ee.HTTPRequest = httpRequest
+		if f.AlwaysServiceContext {
+			ee.ServiceContext = f.entryServiceContext(ee.Context.Data)
+		}
+	}
+
+	// The origin of the entry is resolved once and used for both the report
+	// location of errors and the source location, which the Logs Explorer
+	// links to. Errors carrying their own stack trace originate where they
+	// were created. If logrus already reported the caller, there's no need
+	// to walk the stack again, unless frames above it are to be skipped.
+	if severity.isError() || !f.DisableSourceLocation {
+		var origin *runtime.Frame
+		if len(frames) > 0 {
+			origin = &frames[0]
+		} else if e.Caller != nil && f.CallerSkip == 0 && !f.skipFrame(*e.Caller) {
+			origin = e.Caller
+		} else if c, err := f.errorOrigin(); err == nil {
+			frame := c.Frame()
+			origin = &frame
+		}
+
+		if origin != nil {
+			file, function := frameLocation(*origin)
+
+			if severity.isError() {
+				ee.Context.ReportLocation = &reportLocation{
+					FilePath:     file,
+					LineNumber:   origin.Line,
+					FunctionName: function,
+				}
+			}
+			if !f.DisableSourceLocation {
+				ee.SourceLocation = &sourceLocation{
+					File:     file,
+					Line:     strconv.Itoa(origin.Line),
+					Function: function,
+				}
+			}
+		}
+	}
+
+	if f.TrimPathPrefix != "" {
+		if ee.SourceLocation != nil {
+			ee.SourceLocation.File = strings.TrimPrefix(ee.SourceLocation.File, f.TrimPathPrefix)
+		}
+		if ee.Context.ReportLocation != nil {
+			ee.Context.ReportLocation.FilePath = strings.TrimPrefix(ee.Context.ReportLocation.FilePath, f.TrimPathPrefix)
+		}
+		for i := range ee.Context.ReportLocations {
+			ee.Context.ReportLocations[i].FilePath = strings.TrimPrefix(ee.Context.ReportLocations[i].FilePath, f.TrimPathPrefix)
+		}
+	}
+
+	operationIDKey := orDefault(f.OperationIDKey, fieldNameOperationID)
+	if operationId := getStringValue(operationIDKey, ee.Context.Data); operationId != "" {
+		ee.Operation = &operation{
+			Id: operationId,
+		}
+		delete(ee.Context.Data, operationIDKey)
+	}
+
+	// The producer and the first and last flags allow Cloud Logging to group
+	// the entries of an operation.
+	if producer := getStringValue(fieldNameOperationProducer, ee.Context.Data); producer != "" {
+		if ee.Operation == nil {
+			ee.Operation = &operation{}
+		}
+		ee.Operation.Producer = producer
+		delete(ee.Context.Data, fieldNameOperationProducer)
+	}
+	if first, ok := getBoolValue(fieldNameOperationFirst, ee.Context.Data); ok {
+		if ee.Operation == nil {
+			ee.Operation = &operation{}
+		}
+		ee.Operation.First = &first
+		delete(ee.Context.Data, fieldNameOperationFirst)
+	}
+	if last, ok := getBoolValue(fieldNameOperationLast, ee.Context.Data); ok {
+		if ee.Operation == nil {
+			ee.Operation = &operation{}
+		}
+		ee.Operation.Last = &last
+		delete(ee.Context.Data, fieldNameOperationLast)
+	}
+	if ee.Operation != nil && ee.Operation.Id != "" && ee.Operation.Producer == "" {
+		ee.Operation.Producer = f.OperationProducer
+	}
+
+	if insertID := getStringValue(fieldNameInsertID, ee.Context.Data); insertID != "" {
+		ee.InsertID = insertID
+		delete(ee.Context.Data, fieldNameInsertID)
+	} else if f.InsertIDGenerator != nil {
+		ee.InsertID = f.InsertIDGenerator()
+	}
+
+	// Add tracing information to all logs if available
+	traceIDKey := orDefault(f.TraceIDKey, fieldNameTraceID)
+	if traceId := getStringValue(traceIDKey, ee.Context.Data); traceId != "" {
+		ee.Trace = traceId
+		delete(ee.Context.Data, traceIDKey)
+	}
+	spanIDKey := orDefault(f.SpanIDKey, fieldNameSpanID)
+	spanId := getStringValue(spanIDKey, ee.Context.Data)
+	ee.SpanID = spanId
+	if traceParent := getStringValue(fieldNameTraceParent, ee.Context.Data); traceParent != "" {
+		if traceID, spanID, sampled, ok := parseTraceParent(traceParent); ok {
+			if ee.Trace == "" {
+				ee.Trace = traceID
+				ee.TraceSampled = sampled
+			}
+			if ee.SpanID == "" {
+				ee.SpanID = spanID
+			}
+			delete(ee.Context.Data, fieldNameTraceParent)
+		}
+	}
+	cloudTraceContextKey := orDefault(f.CloudTraceContextKey, fieldNameCloudTraceContext)
+	if traceContext := getStringValue(cloudTraceContextKey, ee.Context.Data); traceContext != "" {
+		if traceID, spanID, sampled, ok := parseCloudTraceContext(traceContext); ok {
+			if ee.Trace == "" {
+				ee.Trace = traceID
+				ee.TraceSampled = sampled
+			}
+			if ee.SpanID == "" {
+				ee.SpanID = spanID
+			}
+			delete(ee.Context.Data, cloudTraceContextKey)
+		}
+	}
+	if ee.Trace == "" && e.Context != nil && f.SpanContextExtractor != nil {
+		if traceID, spanID, sampled := f.SpanContextExtractor(e.Context); traceID != "" {
+			ee.Trace = traceID
+			ee.SpanID = spanID
+			ee.TraceSampled = sampled
+		}
+	}
+
+	// Cloud Logging ignores span ids without a trace, so the span field is
+	// kept as regular data then.
+	if ee.Trace == "" {
+		ee.SpanID = ""
+	} else if spanId != "" {
+		delete(ee.Context.Data, spanIDKey)
+	}
+
+	// The sampling decision is only meaningful along with a trace.
+	if ee.Trace != "" {
+		for _, key := range []string{fieldNameTraceSampled, fieldNameSampled} {
+			if sampled, ok := getBoolValue(key, ee.Context.Data); ok {
+				ee.TraceSampled = sampled
+				delete(ee.Context.Data, key)
+			}
+		}
+	}
+	if f.NormalizeTraceID {
+		ee.Trace = normalizeTraceID(ee.Trace)
+	}
+	ee.Trace = f.qualifyTrace(ee.Trace)
+
+	if f.ValueEncoder != nil {
+		for k, v := range ee.Context.Data {
+			if v, ok := f.ValueEncoder(k, v); ok {
+				ee.Context.Data[k] = v
+			}
+		}
+	}
+
+	// Errors have no exported fields, so they'd be marshaled as empty
+	// objects.
+	for k, v := range ee.Context.Data {
+		if v, ok := errorStrings(v); ok {
+			ee.Context.Data[k] = v
+		}
+	}
+
+	if f.DurationUnit > 0 {
+		for k, v := range ee.Context.Data {
+			if d, ok := v.(time.Duration); ok {
+				ee.Context.Data[k] = float64(d) / float64(f.DurationUnit)
+			}
+		}
+	}
+
+	if f.MaxDepth > 0 {
+		f.limitDepth(ee.Context.Data)
+	}
+
+	ee.Labels = f.labels(ee.Context.Data)
+
+	if f.ResourceType != "" {
+		ee.Resource = &monitoredResource{
+			Type:   f.ResourceType,
+			Labels: f.ResourceLabels,
+		}
+	}
+
+	if f.StripANSI {
+		ee.Message = ansiSequence.ReplaceAllString(ee.Message, "")
+	}
+
+	if len(f.FieldAllowlist) > 0 || len(f.FieldDenylist) > 0 {
+		f.filterFields(ee.Context.Data)
+	}
+
+	renameReservedKeys(ee.Context.Data, orDefault(f.ReservedKeyPrefix, DefaultReservedKeyPrefix))
+
+	// Error Reporting expects the fields as part of the error context, so
+	// only other entries get a flat payload.
+	if f.FlatPayload && !severity.isError() {
+		if len(ee.Context.Data) > 0 {
+			ee.Payload = ee.Context.Data
+		}
+		ee.Context.Data = nil
+	}
+
+	// Don't emit an empty context object.
+	if ee.Context.empty() {
+		ee.Context = nil
+	}
+
+	if f.TextPayloadForPlain && f.plain(&ee) {
+		return []byte(ee.Message + "\n"), nil
+	}
+
+	b, err := f.marshal(&ee, e.Buffer)
+	if err != nil {
+		// Rather than losing the entry, emit it without the fields, which
+		// are most likely the ones that failed to marshal.
+		ee.replaceData(map[string]interface{}{
+			"_marshalError": err.Error(),
+		})
+		// The request and audit log are taken from the fields, so they may
+		// hold the culprit as well.
+		ee.HTTPRequest = dropUnmarshalable(ee.HTTPRequest)
+		if ee.Context != nil {
+			ee.Context.HTTPRequest = dropUnmarshalable(ee.Context.HTTPRequest)
+		}
+		ee.ProtoPayload = dropUnmarshalable(ee.ProtoPayload)
+		return f.marshal(&ee, e.Buffer)
+	}
+
+	// Entries exceeding the size limit are rejected by Cloud Logging, so
+	// rather drop the fields, which are the usual culprit.
+	if f.MaxEntryBytes > 0 && len(b) > f.MaxEntryBytes {
+		ee.replaceData(map[string]interface{}{
+			"_truncated": true,
+		})
+		return f.marshal(&ee, e.Buffer)
+	}
+	return b, nil
+}
+
+// plain reports whether ee carries nothing but its message, severity and
+// locations, so it can be emitted as plain text.
+func (f *Formatter) plain(ee *entry) bool {
+	return !ee.Severity.isError() &&
+		ee.Context == nil &&
+		ee.ServiceContext == nil &&
+		ee.Resource == nil &&
+		len(ee.Payload) == 0 &&
+		ee.Trace == "" &&
+		ee.Operation == nil &&
+		ee.ProtoPayload == nil &&
+		ee.HTTPRequest == nil &&
+		len(ee.Labels) == 0 &&
+		ee.InsertID == "" &&
+		!strings.ContainsAny(ee.Message, "\r\n")
+}
+
+// marshal serializes ee, into buf if it isn't nil.
+func (f *Formatter) marshal(ee *entry, buf *bytes.Buffer) ([]byte, error) {
+	// The extra timestamp is serialized along with the payload, without
+	// becoming a part of it.
+	if _, ok := ee.Payload[f.ExtraTimeKey]; !ok && f.ExtraTimeKey != "" && ee.Timestamp != nil {
+		payload := ee.Payload
+		defer func() { ee.Payload = payload }()
+
+		ee.Payload = make(map[string]interface{}, len(payload)+1)
+		for k, v := range payload {
+			ee.Payload[k] = v
+		}
+		ee.Payload[f.ExtraTimeKey] = ee.Timestamp
+	}
+
+	b, err := f.encode(ee, buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.FieldKeyMap) > 0 {
+		if b, err = renameKeys(b, f.FieldKeyMap); err != nil {
+			return nil, err
+		}
+	}
+	if f.Pretty {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, bytes.TrimSpace(b), "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		b = buf.Bytes()
+	}
+	return b, nil
+}
+
+func (f *Formatter) encode(ee *entry, buf *bytes.Buffer) ([]byte, error) {
+	if f.Marshaler != nil {
+		return marshalEntry(f.Marshaler, ee)
+	}
+
+	// logrus provides a scratch buffer, which it writes out before reusing
+	// it, so there's no need to copy its contents. Hooks may have used it
+	// already, hence only the part written here is returned.
+	if buf != nil {
+		start := buf.Len()
+		if err := encodeEntry(buf, ee); err != nil {
+			buf.Truncate(start)
+			return nil, err
+		}
+		return buf.Bytes()[start:], nil
+	}
+
+	buf = bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	if err := encodeEntry(buf, ee); err != nil {
+		return nil, err
+	}
+
+	// The buffer is reused, so hand out a copy of its contents.
+	b := make([]byte, buf.Len())
+	copy(b, buf.Bytes())
+	return b, nil
+}
+
+// labels merges the configured labels with the labels supplied in the log
+// fields and those added by options, e.g. WithComponent. Labels only accept
+// string values, so field values are coerced.
+func (f *Formatter) labels(data map[string]interface{}) map[string]string {
+	labels := make(map[string]string, len(f.Labels))
+	for k, v := range f.Labels {
+		labels[k] = v
+	}
+
+	switch fields := data["labels"].(type) {
+	case map[string]string:
+		for k, v := range fields {
+			labels[k] = v
+		}
+		delete(data, "labels")
+	case map[string]interface{}:
+		for k, v := range fields {
+			labels[k] = fmt.Sprint(v)
+		}
+		delete(data, "labels")
+	case logrus.Fields:
+		for k, v := range fields {
+			labels[k] = fmt.Sprint(v)
+		}
+		delete(data, "labels")
+	}
+
+	if f.LabelPrefix != "" {
+		for k, v := range data {
+			if strings.HasPrefix(k, f.LabelPrefix) {
+				labels[strings.TrimPrefix(k, f.LabelPrefix)] = fmt.Sprint(v)
+				delete(data, k)
+			}
+		}
+	}
+
+	if f.Component != "" {
+		labels[labelComponent] = f.Component
+	}
+	if f.sequence != nil {
+		labels[labelSequence] = strconv.FormatUint(atomic.AddUint64(f.sequence, 1), 10)
+	}
+	if f.BuildCommit != "" {
+		labels[labelBuildCommit] = f.BuildCommit
+	}
+	if f.BuildTime != "" {
+		labels[labelBuildTime] = f.BuildTime
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	// All labels are normalized at once, so collisions between any of them
+	// are detected.
+	labels, dropped := normalizeLabelKeys(labels, f.LabelKeyCase)
+	if len(dropped) > 0 {
+		data[fieldNameLabelKeyCollisions] = dropped
+	}
+	return labels
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// getStringValue returns the value of key as a string. Besides strings,
+// integers and fmt.Stringer values, e.g. typed ids, are accepted.
+func getStringValue(key string, context map[string]interface{}) string {
+	switch val := context[key].(type) {
+	case string:
+		return val
+	case fmt.Stringer:
+		// A nil pointer would panic in most String methods.
+		if v := reflect.ValueOf(val); v.Kind() == reflect.Ptr && v.IsNil() {
+			return ""
+		}
+		return val.String()
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(val)
+	}
+	return ""
+}
+
+func getBoolValue(key string, context map[string]interface{}) (bool, bool) {
+	switch val := context[key].(type) {
+	case bool:
+		return val, true
+	case string:
+		if boolVal, err := strconv.ParseBool(val); err == nil {
+			return boolVal, true
+		}
+	}
+	return false, false
 }
@@ -55,7 +55,7 @@ var formatterTests = []struct {
 			"sourceLocation": map[string]interface{}{
 				"file":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
 				"line":     "45",
-				"function": "glob..func1",
+				"function": "init.func1",
 			},
 		},
 	},
@@ -77,9 +77,14 @@ var formatterTests = []struct {
 				"reportLocation": map[string]interface{}{
 					"filePath":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
 					"lineNumber":   64.0,
-					"functionName": "glob..func2",
+					"functionName": "init.func2",
 				},
 			},
+			"sourceLocation": map[string]interface{}{
+				"file":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
+				"line":     "64",
+				"function": "init.func2",
+			},
 		},
 	},
 	{
@@ -102,10 +107,15 @@ var formatterTests = []struct {
 				},
 				"reportLocation": map[string]interface{}{
 					"filePath":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
-					"lineNumber":   90.0,
-					"functionName": "glob..func3",
+					"lineNumber":   95.0,
+					"functionName": "init.func3",
 				},
 			},
+			"sourceLocation": map[string]interface{}{
+				"file":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
+				"line":     "95",
+				"function": "init.func3",
+			},
 		},
 	},
 	{
@@ -135,10 +145,82 @@ var formatterTests = []struct {
 				},
 				"reportLocation": map[string]interface{}{
 					"filePath":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
-					"lineNumber":   120.0,
-					"functionName": "glob..func4",
+					"lineNumber":   130.0,
+					"functionName": "init.func4",
+				},
+			},
+			"sourceLocation": map[string]interface{}{
+				"file":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
+				"line":     "130",
+				"function": "init.func4",
+			},
+		},
+	},
+	{
+		run: func(logger *logrus.Logger) {
+			logger.SetLevel(logrus.TraceLevel)
+			logger.WithField("foo", "bar").Trace("my log entry")
+		},
+		out: map[string]interface{}{
+			"severity": "DEBUG",
+			"message":  "my log entry",
+			"context": map[string]interface{}{
+				"data": map[string]interface{}{
+					"foo": "bar",
 				},
 			},
+			"sourceLocation": map[string]interface{}{
+				"file":     "github.com/connctd/logrus-stackdriver-formatter/formatter_test.go",
+				"line":     "162",
+				"function": "init.func5",
+			},
 		},
 	},
 }
+
+func TestFormatterEmptyContext(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if context, ok := got["context"]; ok {
+		t.Errorf("unexpected context = %# v", pretty.Formatter(context))
+	}
+}
+
+func TestFormatterNilData(t *testing.T) {
+	f := NewFormatter(
+		WithService("test"),
+		WithKeepErrorField(),
+		WithFlatPayload(),
+		WithLabelPrefix("label."),
+		WithRedactKeys("password"),
+	)
+
+	for _, level := range []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel} {
+		e := &logrus.Entry{
+			Level:   level,
+			Message: "my log entry",
+		}
+
+		b, err := f.Format(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if want := "my log entry"; got["message"] != want {
+			t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+		}
+	}
+}
@@ -4,7 +4,8 @@ require (
 	github.com/go-stack/stack v1.8.0
 	github.com/kr/pretty v0.1.0
 	github.com/kr/text v0.1.0
-	github.com/sirupsen/logrus v1.0.6
+	github.com/pkg/errors v0.9.1
+	github.com/sirupsen/logrus v1.8.1
 	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793
 	golang.org/x/sys v0.0.0-20180905080454-ebe1bf3edb33
 )
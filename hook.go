@@ -0,0 +1,157 @@
+package stackdriver
+
+import (
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/go-stack/stack"
+	"github.com/sirupsen/logrus"
+)
+
+type fatalHook struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFatalHook returns a hook which synchronously writes fatal and panic
+// entries to w and flushes it, if w implements Flush() or Sync(). Use it if
+// the logger writes to a buffered transport, which might lose the last entry
+// when the process exits. Entries are formatted with the logger's Formatter.
+//
+// Hooks fire before logrus writes to the logger's Out, so w must be a
+// separate, synchronous writer, e.g. os.Stderr, rather than the transport
+// itself. The entries are written to both w and Out.
+func NewFatalHook(w io.Writer) logrus.Hook {
+	return &fatalHook{w: w}
+}
+
+func (h *fatalHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel, logrus.PanicLevel}
+}
+
+func (h *fatalHook) Fire(e *logrus.Entry) error {
+	b, err := format(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.w.Write(b); err != nil {
+		return err
+	}
+
+	switch w := h.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+type splitHook struct {
+	mu        sync.Mutex
+	stdout    io.Writer
+	stderr    io.Writer
+	threshold logrus.Level
+}
+
+// NewSplitHook returns a hook which writes entries at threshold or above,
+// e.g. logrus.ErrorLevel, to stderr and all others to stdout. Entries are
+// formatted with the logger's Formatter. logrus still writes every entry to
+// the logger's Out as well, so set it to ioutil.Discard.
+func NewSplitHook(stdout, stderr io.Writer, threshold logrus.Level) logrus.Hook {
+	return &splitHook{
+		stdout:    stdout,
+		stderr:    stderr,
+		threshold: threshold,
+	}
+}
+
+func (h *splitHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *splitHook) Fire(e *logrus.Entry) error {
+	b, err := format(e)
+	if err != nil {
+		return err
+	}
+
+	w := h.stdout
+	if e.Level <= h.threshold {
+		w = h.stderr
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err = w.Write(b)
+	return err
+}
+
+// format formats e with the logger's Formatter, or a default Formatter if
+// there is none. Walking the stack from within a hook would locate the hook,
+// so the caller is resolved here for a Formatter of this package.
+func format(e *logrus.Entry) ([]byte, error) {
+	var formatter logrus.Formatter = NewFormatter()
+	if e.Logger != nil && e.Logger.Formatter != nil {
+		formatter = e.Logger.Formatter
+	}
+
+	// Formatting modifies the fields, which logrus shares between all hooks
+	// and the entry written by the logger itself.
+	entry := copyEntry(e)
+
+	f, ok := formatter.(*Formatter)
+	if !ok || (e.Caller != nil && f.CallerSkip == 0 && !f.skipFrame(*e.Caller)) {
+		return formatter.Format(entry)
+	}
+
+	if frame, ok := f.hookCaller(); ok {
+		entry.Caller = &frame
+	}
+	// The frames above the caller have been skipped already.
+	if f.CallerSkip > 0 {
+		fmtr := *f
+		fmtr.CallerSkip = 0
+		f = &fmtr
+	}
+	return f.Format(entry)
+}
+
+// copyEntry returns a copy of e with a copy of its fields, which Format
+// modifies.
+func copyEntry(e *logrus.Entry) *logrus.Entry {
+	entry := *e
+	entry.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		entry.Data[k] = v
+	}
+	return &entry
+}
+
+// hookCaller returns the frame which logged an entry, as seen from a hook. It
+// is the first frame after those of the skipped packages calling the hook,
+// e.g. logrus, plus CallerSkip frames.
+func (f *Formatter) hookCaller() (runtime.Frame, bool) {
+	calls := stack.Trace().TrimRuntime()
+	skipped := false
+	for i, c := range calls {
+		if f.skip(c) {
+			skipped = true
+			continue
+		}
+		if !skipped {
+			continue
+		}
+		if i += f.CallerSkip; i < len(calls) {
+			return calls[i].Frame(), true
+		}
+		break
+	}
+	return runtime.Frame{}, false
+}
@@ -0,0 +1,162 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type flushWriter struct {
+	bytes.Buffer
+	flushed int
+}
+
+func (w *flushWriter) Flush() error {
+	w.flushed++
+	return nil
+}
+
+func TestFatalHook(t *testing.T) {
+	var w flushWriter
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = NewFormatter()
+	logger.AddHook(NewFatalHook(&w))
+
+	logger.Error("my error entry")
+	if w.Len() != 0 {
+		t.Errorf("unexpected output for error entry = %s", w.String())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		logger.Panic("my panic entry")
+	}()
+
+	var got map[string]interface{}
+	json.Unmarshal(w.Bytes(), &got)
+
+	if want := "my panic entry"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+	if want := "ALERT"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+	if want := 1; w.flushed != want {
+		t.Errorf("unexpected flushes = %d; want = %d", w.flushed, want)
+	}
+}
+
+func TestFatalHookKeepsEntry(t *testing.T) {
+	var out, w bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+	logger.AddHook(NewFatalHook(&w))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		logger.WithError(errors.New("boom")).
+			WithField("ot-tracer-traceid", "abc").
+			Panic("my panic")
+	}()
+
+	for _, tt := range []struct {
+		name string
+		out  *bytes.Buffer
+	}{
+		{"hook", &w},
+		{"logger", &out},
+	} {
+		var got map[string]interface{}
+		if err := json.Unmarshal(tt.out.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error decoding %s = %v", tt.name, err)
+		}
+		if want := "my panic: boom"; got["message"] != want {
+			t.Errorf("unexpected message on %s = %v; want = %v", tt.name, got["message"], want)
+		}
+		if want := "abc"; got["logging.googleapis.com/trace"] != want {
+			t.Errorf("unexpected trace on %s = %v; want = %v", tt.name, got["logging.googleapis.com/trace"], want)
+		}
+	}
+}
+
+func TestSplitHook(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = NewFormatter()
+	logger.AddHook(NewSplitHook(&stdout, &stderr, logrus.ErrorLevel))
+
+	logger.Info("my info entry")
+	logger.Error("my error entry")
+
+	for _, tt := range []struct {
+		name string
+		out  *bytes.Buffer
+		want string
+	}{
+		{"stdout", &stdout, "my info entry"},
+		{"stderr", &stderr, "my error entry"},
+	} {
+		dec := json.NewDecoder(tt.out)
+
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("unexpected error decoding %s = %v", tt.name, err)
+		}
+		if got["message"] != tt.want {
+			t.Errorf("unexpected message on %s = %v; want = %v", tt.name, got["message"], tt.want)
+		}
+		sourceLocation, _ := got["sourceLocation"].(map[string]interface{})
+		if want := "TestSplitHook"; sourceLocation["function"] != want {
+			t.Errorf("unexpected function on %s = %v; want = %v", tt.name, sourceLocation["function"], want)
+		}
+		if dec.More() {
+			t.Errorf("unexpected entries on %s", tt.name)
+		}
+	}
+}
+
+func TestSplitHooks(t *testing.T) {
+	var first, second bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = NewFormatter()
+	logger.AddHook(NewSplitHook(&first, &first, logrus.ErrorLevel))
+	logger.AddHook(NewSplitHook(&second, &second, logrus.ErrorLevel))
+
+	logger.WithError(errors.New("boom")).Error("split")
+
+	for _, tt := range []struct {
+		name string
+		out  *bytes.Buffer
+	}{
+		{"first", &first},
+		{"second", &second},
+	} {
+		var got map[string]interface{}
+		if err := json.Unmarshal(tt.out.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error decoding %s = %v", tt.name, err)
+		}
+		if want := "split: boom"; got["message"] != want {
+			t.Errorf("unexpected message on %s = %v; want = %v", tt.name, got["message"], want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package stackdriver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPRequestField returns an httpRequest field for r, shaped the way Cloud
+// Logging expects it.
+func HTTPRequestField(r *http.Request, status int, latency time.Duration) logrus.Fields {
+	req := map[string]interface{}{
+		"requestMethod": r.Method,
+		"requestUrl":    r.URL.String(),
+		"status":        status,
+		"userAgent":     r.UserAgent(),
+		"referer":       r.Referer(),
+		"protocol":      r.Proto,
+		"latency":       formatDuration(latency),
+	}
+	if r.ContentLength > 0 {
+		req["requestSize"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req["remoteIp"] = host
+	} else if r.RemoteAddr != "" {
+		req["remoteIp"] = r.RemoteAddr
+	}
+
+	return logrus.Fields{
+		"httpRequest": req,
+	}
+}
+
+// liftHTTPRequest removes the httpRequest field from data and returns it
+// normalized. The field is also accepted nested in a context field, the way
+// it appears in error entries. A top level field takes precedence, leaving a
+// nested one as regular data.
+func liftHTTPRequest(data map[string]interface{}) map[string]interface{} {
+	if req, ok := data["httpRequest"].(map[string]interface{}); ok {
+		delete(data, "httpRequest")
+		return normalizeHTTPRequest(req)
+	}
+
+	context, ok := data["context"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	req, ok := context["httpRequest"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	// The context field may be shared between entries, so it's copied rather
+	// than modified in place.
+	rest := make(map[string]interface{}, len(context)-1)
+	for k, v := range context {
+		if k != "httpRequest" {
+			rest[k] = v
+		}
+	}
+	if len(rest) > 0 {
+		data["context"] = rest
+	} else {
+		delete(data, "context")
+	}
+	return normalizeHTTPRequest(req)
+}
+
+// normalizeHTTPRequest converts the values of req to the types Cloud Logging
+// expects, e.g. a time.Duration latency to a duration string or a status
+// decoded from JSON to an integer. req is copied rather than modified in
+// place.
+func normalizeHTTPRequest(req map[string]interface{}) map[string]interface{} {
+	var normalized map[string]interface{}
+	set := func(k string, v interface{}) {
+		if normalized == nil {
+			normalized = make(map[string]interface{}, len(req))
+			for k, v := range req {
+				normalized[k] = v
+			}
+		}
+		normalized[k] = v
+	}
+
+	if latency, ok := req["latency"].(time.Duration); ok {
+		set("latency", formatDuration(latency))
+	}
+	for _, k := range []string{"status", "responseSize"} {
+		if n, ok := toInteger(req[k]); ok {
+			set(k, n)
+		}
+	}
+
+	if normalized == nil {
+		return req
+	}
+	return normalized
+}
+
+// toInteger converts strings and floats holding an integer to an int64. Other
+// values, including integers, are reported as not converted.
+func toInteger(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case float32:
+		return toInteger(float64(v))
+	case float64:
+		return int64(v), v == math.Trunc(v) && !math.IsInf(v, 0)
+	}
+	return 0, false
+}
+
+// withRemoteIP returns a copy of req with its remoteIp set to ip.
+func withRemoteIP(req map[string]interface{}, ip string) map[string]interface{} {
+	c := make(map[string]interface{}, len(req)+1)
+	for k, v := range req {
+		c[k] = v
+	}
+	c["remoteIp"] = ip
+	return c
+}
+
+// formatDuration formats d as a google.protobuf.Duration, e.g. "0.123s".
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,372 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHTTPRequestInfo(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithFields(logrus.Fields{
+			"foo": "bar",
+			"httpRequest": map[string]interface{}{
+				"requestMethod": "GET",
+				"status":        200,
+				"latency":       "0.123s",
+			},
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"requestMethod": "GET",
+		"status":        200.0,
+		"latency":       "0.123s",
+	}
+
+	if !reflect.DeepEqual(got["httpRequest"], want) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(want))
+	}
+	if context := got["context"]; !reflect.DeepEqual(context, map[string]interface{}{"data": map[string]interface{}{"foo": "bar"}}) {
+		t.Errorf("unexpected context = %# v", pretty.Formatter(context))
+	}
+}
+
+func TestHTTPRequestError(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithField("httpRequest", map[string]interface{}{
+			"requestMethod": "GET",
+			"status":        500,
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"requestMethod": "GET",
+		"status":        500.0,
+	}
+
+	if req := got["context"].(map[string]interface{})["httpRequest"]; !reflect.DeepEqual(req, want) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(req), pretty.Formatter(want))
+	}
+	if req, ok := got["httpRequest"]; ok {
+		t.Errorf("unexpected top level httpRequest = %# v", pretty.Formatter(req))
+	}
+}
+
+func TestHTTPRequestField(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.com/foo?bar=baz", strings.NewReader("body"))
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set("Referer", "http://example.com/")
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	got := HTTPRequestField(r, 201, 123*time.Millisecond)
+
+	want := logrus.Fields{
+		"httpRequest": map[string]interface{}{
+			"requestMethod": "POST",
+			"requestUrl":    "http://example.com/foo?bar=baz",
+			"requestSize":   "4",
+			"status":        201,
+			"userAgent":     "test-agent",
+			"referer":       "http://example.com/",
+			"remoteIp":      "192.0.2.1",
+			"protocol":      "HTTP/1.1",
+			"latency":       "0.123s",
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected field = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(want))
+	}
+}
+
+func TestHTTPRequestLatency(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithField("httpRequest", map[string]interface{}{
+			"requestMethod": "GET",
+			"latency":       3500 * time.Millisecond,
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"requestMethod": "GET",
+		"latency":       "3.5s",
+	}
+
+	if !reflect.DeepEqual(got["httpRequest"], want) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(want))
+	}
+}
+
+func TestHTTPRequestNested(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+		data   interface{}
+	}{
+		{
+			name: "top level",
+			fields: logrus.Fields{
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+			},
+		},
+		{
+			name: "nested",
+			fields: logrus.Fields{
+				"context": map[string]interface{}{
+					"httpRequest": map[string]interface{}{
+						"requestMethod": "GET",
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+			},
+		},
+		{
+			name: "nested with other fields",
+			fields: logrus.Fields{
+				"context": map[string]interface{}{
+					"foo": "bar",
+					"httpRequest": map[string]interface{}{
+						"requestMethod": "GET",
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+			},
+			data: map[string]interface{}{
+				"field.context": map[string]interface{}{
+					"foo": "bar",
+				},
+			},
+		},
+		{
+			name: "both",
+			fields: logrus.Fields{
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+				},
+				"context": map[string]interface{}{
+					"httpRequest": map[string]interface{}{
+						"requestMethod": "POST",
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+			},
+			data: map[string]interface{}{
+				"field.context": map[string]interface{}{
+					"httpRequest": map[string]interface{}{
+						"requestMethod": "POST",
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["httpRequest"], tt.want) {
+				t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(tt.want))
+			}
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
+
+func TestHTTPRequestStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "int",
+			value: 200,
+			want:  200.0,
+		},
+		{
+			name:  "string",
+			value: "200",
+			want:  200.0,
+		},
+		{
+			name:  "float",
+			value: 200.0,
+			want:  200.0,
+		},
+		{
+			name:  "invalid string",
+			value: "OK",
+			want:  "OK",
+		},
+		{
+			name:  "fractional float",
+			value: 200.5,
+			want:  200.5,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.
+				WithField("httpRequest", map[string]interface{}{
+					"status":       tt.value,
+					"responseSize": tt.value,
+				}).
+				Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			want := map[string]interface{}{
+				"status":       tt.want,
+				"responseSize": tt.want,
+			}
+
+			if !reflect.DeepEqual(got["httpRequest"], want) {
+				t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(want))
+			}
+		})
+	}
+}
+
+func TestRemoteIPKey(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+		data   interface{}
+	}{
+		{
+			name: "present",
+			fields: logrus.Fields{
+				"clientIp": "192.0.2.1",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+				"remoteIp":      "192.0.2.1",
+			},
+		},
+		{
+			name: "absent",
+			fields: logrus.Fields{
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+			},
+		},
+		{
+			name: "remoteIp set",
+			fields: logrus.Fields{
+				"clientIp": "192.0.2.1",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"remoteIp":      "192.0.2.2",
+				},
+			},
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+				"remoteIp":      "192.0.2.2",
+			},
+			data: map[string]interface{}{
+				"clientIp": "192.0.2.1",
+			},
+		},
+		{
+			name: "without httpRequest",
+			fields: logrus.Fields{
+				"clientIp": "192.0.2.1",
+			},
+			data: map[string]interface{}{
+				"clientIp": "192.0.2.1",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(WithRemoteIPKey("clientIp"))
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["httpRequest"], tt.want) {
+				t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(got["httpRequest"]), pretty.Formatter(tt.want))
+			}
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
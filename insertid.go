@@ -0,0 +1,62 @@
+package stackdriver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// InsertIDStrategy is the way insert ids are generated for entries without
+// an insertId field.
+type InsertIDStrategy int
+
+const (
+	// InsertIDNone leaves generating insert ids to Cloud Logging.
+	InsertIDNone InsertIDStrategy = iota
+	// InsertIDRandom generates random insert ids, which allow Cloud Logging
+	// to deduplicate entries written more than once.
+	InsertIDRandom
+	// InsertIDMonotonic generates insert ids from the time the Formatter was
+	// configured and a counter, which order entries with identical
+	// timestamps as they were logged.
+	InsertIDMonotonic
+)
+
+// WithInsertIDStrategy lets you configure how insert ids are generated,
+// replacing a generator configured with WithInsertIDGenerator.
+func WithInsertIDStrategy(s InsertIDStrategy) Option {
+	return func(f *Formatter) {
+		switch s {
+		case InsertIDNone:
+			f.InsertIDGenerator = nil
+		case InsertIDRandom:
+			f.InsertIDGenerator = randomInsertID
+		case InsertIDMonotonic:
+			f.InsertIDGenerator = monotonicInsertIDs()
+		}
+	}
+}
+
+// randomInsertID returns 32 random hex characters.
+func randomInsertID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// monotonicInsertIDs returns a generator of insert ids, which sort in the
+// order they were generated. They consist of the time the generator was
+// created, which tells apart the ids of different processes, and a counter,
+// both zero padded. The wall clock may go backwards, so only the counter
+// orders the ids.
+func monotonicInsertIDs() func() string {
+	start := time.Now().UnixNano()
+	var n uint64
+	return func() string {
+		return fmt.Sprintf("%016x-%016x", start, atomic.AddUint64(&n, 1))
+	}
+}
@@ -0,0 +1,140 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestInsertID(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithField("insertId", "my-insert-id").Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "my-insert-id"; got["logging.googleapis.com/insertId"] != want {
+		t.Errorf("unexpected insert id = %v; want = %v", got["logging.googleapis.com/insertId"], want)
+	}
+	if context, ok := got["context"]; ok {
+		t.Errorf("unexpected context = %v", context)
+	}
+}
+
+func TestInsertIDGenerator(t *testing.T) {
+	var n int
+
+	logger := logrus.New()
+	logger.Formatter = NewFormatter(
+		WithInsertIDGenerator(func() string {
+			n++
+			return fmt.Sprintf("%08d", n)
+		}),
+	)
+
+	for _, tt := range []struct {
+		fields logrus.Fields
+		want   string
+	}{
+		{
+			want: "00000001",
+		},
+		{
+			fields: logrus.Fields{"insertId": "my-insert-id"},
+			want:   "my-insert-id",
+		},
+		{
+			want: "00000002",
+		},
+	} {
+		var out bytes.Buffer
+		logger.Out = &out
+
+		logger.WithFields(tt.fields).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/insertId"] != tt.want {
+			t.Errorf("unexpected insert id = %v; want = %v", got["logging.googleapis.com/insertId"], tt.want)
+		}
+	}
+}
+
+func TestInsertIDStrategy(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		strategy InsertIDStrategy
+		ordered  bool
+	}{
+		{name: "random", strategy: InsertIDRandom},
+		{name: "monotonic", strategy: InsertIDMonotonic, ordered: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithInsertIDStrategy(tt.strategy),
+			)
+
+			for i := 0; i < 100; i++ {
+				logger.Info("my log entry")
+			}
+
+			seen := make(map[string]bool)
+			var prev string
+
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				if err := dec.Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+
+				id, _ := got["logging.googleapis.com/insertId"].(string)
+				if id == "" {
+					t.Fatal("missing insert id")
+				}
+				if seen[id] {
+					t.Errorf("duplicate insert id = %v", id)
+				}
+				seen[id] = true
+
+				if tt.ordered && id <= prev {
+					t.Errorf("unexpected insert id = %v; want after = %v", id, prev)
+				}
+				prev = id
+			}
+		})
+	}
+}
+
+func TestInsertIDStrategyNone(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithInsertIDGenerator(func() string { return "my-insert-id" }),
+		WithInsertIDStrategy(InsertIDNone),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if id, ok := got["logging.googleapis.com/insertId"]; ok {
+		t.Errorf("unexpected insert id = %v", id)
+	}
+}
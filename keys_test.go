@@ -0,0 +1,289 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCustomKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithSubjectKey("subject"),
+		WithOperationIDKey("requestId"),
+		WithTraceIDKey("traceId"),
+		WithSpanIDKey("spanId"),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"subject":             "user-1",
+			"requestId":           "request-1",
+			"traceId":             "4bf92f3577b34da6a3ce929d0e0e4736",
+			"spanId":              "00f067aa0ba902b7",
+			DefaultOperationIdKey: "ignored",
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	context := got["context"].(map[string]interface{})
+	if want := "user-1"; context["user"] != want {
+		t.Errorf("unexpected user = %v; want = %v", context["user"], want)
+	}
+	if want := map[string]interface{}{"id": "request-1"}; !reflect.DeepEqual(got["operation"], want) {
+		t.Errorf("unexpected operation = %# v; want = %# v", pretty.Formatter(got["operation"]), pretty.Formatter(want))
+	}
+	if want := "4bf92f3577b34da6a3ce929d0e0e4736"; got["logging.googleapis.com/trace"] != want {
+		t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], want)
+	}
+	if want := "00f067aa0ba902b7"; got["logging.googleapis.com/span_id"] != want {
+		t.Errorf("unexpected span id = %v; want = %v", got["logging.googleapis.com/span_id"], want)
+	}
+	if want := map[string]interface{}{DefaultOperationIdKey: "ignored"}; !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+}
+
+func TestCustomKeysConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for _, tt := range []struct {
+		formatter *Formatter
+		want      string
+	}{
+		{NewFormatter(WithSubjectKey("subject")), "user-1"},
+		{NewFormatter(), "user-2"},
+	} {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(f *Formatter, want string) {
+				defer wg.Done()
+
+				var out bytes.Buffer
+
+				logger := logrus.New()
+				logger.Out = &out
+				logger.Formatter = f
+
+				logger.
+					WithFields(logrus.Fields{
+						"subject":         "user-1",
+						DefaultSubjectKey: "user-2",
+					}).
+					Error("my log entry")
+
+				var got map[string]interface{}
+				json.Unmarshal(out.Bytes(), &got)
+
+				if user := got["context"].(map[string]interface{})["user"]; user != want {
+					t.Errorf("unexpected user = %v; want = %v", user, want)
+				}
+			}(tt.formatter, tt.want)
+		}
+	}
+	wg.Wait()
+}
+
+func TestUserKey(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		user   interface{}
+		data   interface{}
+	}{
+		{
+			name: "user",
+			fields: logrus.Fields{
+				"user": "user-1",
+			},
+			user: "user-1",
+		},
+		{
+			name: "subject",
+			fields: logrus.Fields{
+				DefaultSubjectKey: "subject-1",
+			},
+			user: "subject-1",
+		},
+		{
+			name: "both",
+			fields: logrus.Fields{
+				"user":            "user-1",
+				DefaultSubjectKey: "subject-1",
+			},
+			user: "user-1",
+			data: map[string]interface{}{
+				DefaultSubjectKey: "subject-1",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithUserKey("user"),
+			)
+
+			logger.WithFields(tt.fields).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if context["user"] != tt.user {
+				t.Errorf("unexpected user = %v; want = %v", context["user"], tt.user)
+			}
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
+
+type subjectID int
+
+func (id subjectID) String() string {
+	return fmt.Sprintf("subject-%d", int(id))
+}
+
+func TestTypedKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithFields(logrus.Fields{
+			DefaultSubjectKey:     subjectID(1),
+			DefaultOperationIdKey: int64(42),
+			fieldNameTraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+			fieldNameSpanID:       uint64(12345),
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	context, _ := got["context"].(map[string]interface{})
+	if want := "subject-1"; context["user"] != want {
+		t.Errorf("unexpected user = %v; want = %v", context["user"], want)
+	}
+	if want := map[string]interface{}{"id": "42"}; !reflect.DeepEqual(got["operation"], want) {
+		t.Errorf("unexpected operation = %# v; want = %# v", pretty.Formatter(got["operation"]), pretty.Formatter(want))
+	}
+	if want := "12345"; got["logging.googleapis.com/span_id"] != want {
+		t.Errorf("unexpected span id = %v; want = %v", got["logging.googleapis.com/span_id"], want)
+	}
+	if _, ok := context["data"]; ok {
+		t.Errorf("unexpected data = %# v", pretty.Formatter(context["data"]))
+	}
+}
+
+func TestLevelField(t *testing.T) {
+	for _, tt := range []struct {
+		level    logrus.Level
+		severity string
+		want     string
+	}{
+		{logrus.InfoLevel, "INFO", "info"},
+		{logrus.WarnLevel, "WARNING", "warning"},
+		{logrus.ErrorLevel, "ERROR", "error"},
+	} {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithLevelField("level"),
+			)
+
+			logger.Log(tt.level, "my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["severity"] != tt.severity {
+				t.Errorf("unexpected severity = %v; want = %v", got["severity"], tt.severity)
+			}
+			context, _ := got["context"].(map[string]interface{})
+			data, _ := context["data"].(map[string]interface{})
+			if data["level"] != tt.want {
+				t.Errorf("unexpected level = %v; want = %v", data["level"], tt.want)
+			}
+		})
+	}
+}
+
+type requestID string
+
+func (id *requestID) String() string {
+	return string(*id)
+}
+
+func TestNilStringerKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithFields(logrus.Fields{
+			DefaultSubjectKey:     (*requestID)(nil),
+			DefaultOperationIdKey: (*requestID)(nil),
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error = %v; output = %s", err, out.String())
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if _, ok := context["user"]; ok {
+		t.Errorf("unexpected user = %v", context["user"])
+	}
+	if _, ok := got["operation"]; ok {
+		t.Errorf("unexpected operation = %# v", pretty.Formatter(got["operation"]))
+	}
+}
+
+func TestZeroFormatterKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = &Formatter{}
+
+	logger.
+		WithFields(logrus.Fields{
+			DefaultSubjectKey:     "subject",
+			DefaultOperationIdKey: "request",
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	context, _ := got["context"].(map[string]interface{})
+	if want := "subject"; context["user"] != want {
+		t.Errorf("unexpected user = %v; want = %v", context["user"], want)
+	}
+	if want := map[string]interface{}{"id": "request"}; !reflect.DeepEqual(got["operation"], want) {
+		t.Errorf("unexpected operation = %# v; want = %# v", pretty.Formatter(got["operation"]), pretty.Formatter(want))
+	}
+}
@@ -0,0 +1,65 @@
+package stackdriver
+
+import (
+	"sort"
+	"strings"
+)
+
+// LabelKeyCase is the case label keys are normalized to.
+type LabelKeyCase int
+
+const (
+	// LabelKeysUnchanged keeps label keys as they are.
+	LabelKeysUnchanged LabelKeyCase = iota
+	// LabelKeysLower converts label keys to lower case.
+	LabelKeysLower
+	// LabelKeysUpper converts label keys to upper case.
+	LabelKeysUpper
+)
+
+// fieldNameLabelKeyCollisions is the field listing label keys, which were
+// dropped as they collided with others after normalization.
+const fieldNameLabelKeyCollisions = "_labelKeyCollisions"
+
+// WithNormalizeLabelKeys lets you configure the formatter to convert the keys
+// of all labels to lower or upper case, as Cloud Logging treats "Region" and
+// "region" as different labels. If keys collide, the value of the key sorting
+// last wins and the others are listed in the "_labelKeyCollisions" field.
+func WithNormalizeLabelKeys(c LabelKeyCase) Option {
+	return func(f *Formatter) {
+		f.LabelKeyCase = c
+	}
+}
+
+// normalizeLabelKeys returns labels with their keys converted to c, along with
+// the keys dropped due to collisions.
+func normalizeLabelKeys(labels map[string]string, c LabelKeyCase) (map[string]string, []string) {
+	var convert func(string) string
+	switch c {
+	case LabelKeysLower:
+		convert = strings.ToLower
+	case LabelKeysUpper:
+		convert = strings.ToUpper
+	default:
+		return labels, nil
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	normalized := make(map[string]string, len(labels))
+	owners := make(map[string]string, len(labels))
+	var dropped []string
+	for _, k := range keys {
+		nk := convert(k)
+		if owner, ok := owners[nk]; ok {
+			dropped = append(dropped, owner)
+		}
+		owners[nk] = k
+		normalized[nk] = labels[k]
+	}
+	return normalized, dropped
+}
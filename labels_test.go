@@ -0,0 +1,323 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLabels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithLabels(map[string]string{
+			"region": "europe-west1",
+			"tier":   "backend",
+		}),
+	)
+
+	logger.
+		WithField("labels", map[string]interface{}{
+			"tier":    "frontend",
+			"attempt": 3,
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"region":  "europe-west1",
+		"tier":    "frontend",
+		"attempt": "3",
+	}
+
+	if !reflect.DeepEqual(got["logging.googleapis.com/labels"], want) {
+		t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(want))
+	}
+	if context, ok := got["context"]; ok {
+		t.Errorf("unexpected context = %# v", pretty.Formatter(context))
+	}
+}
+
+func TestLabelPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		want   interface{}
+		data   map[string]interface{}
+	}{
+		{
+			prefix: "label.",
+			want: map[string]interface{}{
+				"region": "europe-west1",
+				"tier":   "frontend",
+			},
+			data: map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+		{
+			prefix: "",
+			want: map[string]interface{}{
+				"tier": "backend",
+			},
+			data: map[string]interface{}{
+				"foo":          "bar",
+				"label.region": "europe-west1",
+				"label.tier":   "frontend",
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(
+			WithLabels(map[string]string{
+				"tier": "backend",
+			}),
+			WithLabelPrefix(tt.prefix),
+		)
+
+		logger.
+			WithFields(logrus.Fields{
+				"foo":          "bar",
+				"label.region": "europe-west1",
+				"label.tier":   "frontend",
+			}).
+			Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if !reflect.DeepEqual(got["logging.googleapis.com/labels"], tt.want) {
+			t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(tt.want))
+		}
+		context, _ := got["context"].(map[string]interface{})
+		if data := context["data"]; !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(tt.data))
+		}
+	}
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithSequenceNumbers(),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				logger.Info("my log entry")
+			}
+		}()
+	}
+	wg.Wait()
+
+	var last uint64
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		labels, _ := got["logging.googleapis.com/labels"].(map[string]interface{})
+		seq, _ := labels["sequence"].(string)
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			t.Fatalf("unexpected sequence = %q", seq)
+		}
+		if n <= last {
+			t.Errorf("unexpected sequence = %d; want > %d", n, last)
+		}
+		last = n
+	}
+	if want := uint64(100); last != want {
+		t.Errorf("unexpected last sequence = %d; want = %d", last, want)
+	}
+}
+
+func TestComponent(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithComponent("scheduler"),
+	)
+
+	logger.Info("my log entry")
+	logger.WithField("labels", map[string]string{"component": "other"}).Warn("my log entry")
+	logger.Error("my log entry")
+
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		labels, _ := got["logging.googleapis.com/labels"].(map[string]interface{})
+		if want := "scheduler"; labels["component"] != want {
+			t.Errorf("unexpected component = %v; want = %v", labels["component"], want)
+		}
+	}
+}
+
+func TestNormalizeLabelKeys(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		c      LabelKeyCase
+		fields logrus.Fields
+		want   interface{}
+		data   interface{}
+	}{
+		{
+			name: "lower",
+			c:    LabelKeysLower,
+			fields: logrus.Fields{
+				"labels": map[string]string{"Tier": "frontend"},
+			},
+			want: map[string]interface{}{
+				"region": "europe-west1",
+				"tier":   "frontend",
+			},
+		},
+		{
+			name: "upper",
+			c:    LabelKeysUpper,
+			fields: logrus.Fields{
+				"labels": map[string]string{"Tier": "frontend"},
+			},
+			want: map[string]interface{}{
+				"REGION": "europe-west1",
+				"TIER":   "frontend",
+			},
+		},
+		{
+			name: "collision",
+			c:    LabelKeysLower,
+			fields: logrus.Fields{
+				"labels": map[string]string{"region": "europe-west4"},
+			},
+			want: map[string]interface{}{
+				"region": "europe-west4",
+			},
+			data: map[string]interface{}{
+				"_labelKeyCollisions": []interface{}{"Region"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithLabels(map[string]string{"Region": "europe-west1"}),
+				WithNormalizeLabelKeys(tt.c),
+			)
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["logging.googleapis.com/labels"], tt.want) {
+				t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(tt.want))
+			}
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+		WithBuildInfo("0123456789abcdef", "2018-09-05T08:30:00Z"),
+	)
+
+	logger.Info("my log entry")
+	logger.Error("my log entry")
+
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]interface{}{
+			"build_commit": "0123456789abcdef",
+			"build_time":   "2018-09-05T08:30:00Z",
+		}
+		if !reflect.DeepEqual(got["logging.googleapis.com/labels"], want) {
+			t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(want))
+		}
+		if sc, ok := got["serviceContext"].(map[string]interface{}); ok && sc["version"] != "0.1" {
+			t.Errorf("unexpected version = %v; want = %v", sc["version"], "0.1")
+		}
+	}
+}
+
+func TestNormalizeLabelKeysOptions(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithLabels(map[string]string{"Region": "europe-west1"}),
+		WithComponent("api"),
+		WithSequenceNumbers(),
+		WithBuildInfo("0123456789abcdef", "2018-09-05T08:30:00Z"),
+		WithNormalizeLabelKeys(LabelKeysUpper),
+	)
+
+	logger.
+		WithField("labels", map[string]string{"COMPONENT": "worker"}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"REGION":       "europe-west1",
+		"COMPONENT":    "api",
+		"SEQUENCE":     "1",
+		"BUILD_COMMIT": "0123456789abcdef",
+		"BUILD_TIME":   "2018-09-05T08:30:00Z",
+	}
+	if !reflect.DeepEqual(got["logging.googleapis.com/labels"], want) {
+		t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(want))
+	}
+
+	wantData := map[string]interface{}{
+		"_labelKeyCollisions": []interface{}{"COMPONENT"},
+	}
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["data"], wantData) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(wantData))
+	}
+}
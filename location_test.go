@@ -0,0 +1,174 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func logErrorFromHelper(logger *logrus.Logger) {
+	logger.Error("my log entry")
+}
+
+func TestMultiFrameLocation(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithMultiFrameLocation(2),
+	)
+
+	logErrorFromHelper(logger)
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := []interface{}{
+		map[string]interface{}{
+			"filePath":     "github.com/connctd/logrus-stackdriver-formatter/location_test.go",
+			"lineNumber":   14.0,
+			"functionName": "logErrorFromHelper",
+		},
+		map[string]interface{}{
+			"filePath":     "github.com/connctd/logrus-stackdriver-formatter/location_test.go",
+			"lineNumber":   26.0,
+			"functionName": "TestMultiFrameLocation",
+		},
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["reportLocations"], want) {
+		t.Errorf("unexpected reportLocations = %# v; want = %# v", pretty.Formatter(context["reportLocations"]), pretty.Formatter(want))
+	}
+	if !reflect.DeepEqual(context["reportLocation"], want[0]) {
+		t.Errorf("unexpected reportLocation = %# v; want = %# v", pretty.Formatter(context["reportLocation"]), pretty.Formatter(want[0]))
+	}
+}
+
+func TestWithoutSourceLocation(t *testing.T) {
+	for _, tt := range []struct {
+		level logrus.Level
+		key   string
+		want  bool
+	}{
+		{
+			level: logrus.InfoLevel,
+			key:   "sourceLocation",
+		},
+		{
+			level: logrus.ErrorLevel,
+			key:   "reportLocation",
+			want:  true,
+		},
+	} {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithoutSourceLocation(),
+			)
+
+			logger.Log(tt.level, "my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			_, inContext := context[tt.key]
+			_, atTop := got[tt.key]
+			if found := inContext || atTop; found != tt.want {
+				t.Errorf("unexpected %s = %v; want = %v", tt.key, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimPathPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		want   string
+	}{
+		{
+			prefix: "github.com/connctd/logrus-stackdriver-formatter/",
+			want:   "location_test.go",
+		},
+		{
+			prefix: "github.com/connctd/other/",
+			want:   "github.com/connctd/logrus-stackdriver-formatter/location_test.go",
+		},
+	} {
+		t.Run(tt.prefix, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithTrimPathPrefix(tt.prefix),
+				WithMultiFrameLocation(1),
+			)
+
+			logger.Info("my log entry")
+			logger.Error("my log entry")
+
+			dec := json.NewDecoder(&out)
+
+			var info map[string]interface{}
+			dec.Decode(&info)
+			sourceLocation, _ := info["sourceLocation"].(map[string]interface{})
+			if sourceLocation["file"] != tt.want {
+				t.Errorf("unexpected file = %v; want = %v", sourceLocation["file"], tt.want)
+			}
+
+			var errorEntry map[string]interface{}
+			dec.Decode(&errorEntry)
+			context, _ := errorEntry["context"].(map[string]interface{})
+			reportLocation, _ := context["reportLocation"].(map[string]interface{})
+			if reportLocation["filePath"] != tt.want {
+				t.Errorf("unexpected filePath = %v; want = %v", reportLocation["filePath"], tt.want)
+			}
+			reportLocations, _ := context["reportLocations"].([]interface{})
+			if len(reportLocations) != 1 || reportLocations[0].(map[string]interface{})["filePath"] != tt.want {
+				t.Errorf("unexpected reportLocations = %# v", pretty.Formatter(reportLocations))
+			}
+		})
+	}
+}
+
+func TestErrorSourceLocation(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	wantReport := map[string]interface{}{
+		"filePath":     "github.com/connctd/logrus-stackdriver-formatter/location_test.go",
+		"lineNumber":   151.0,
+		"functionName": "TestErrorSourceLocation",
+	}
+	wantSource := map[string]interface{}{
+		"file":     "github.com/connctd/logrus-stackdriver-formatter/location_test.go",
+		"line":     "151",
+		"function": "TestErrorSourceLocation",
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["reportLocation"], wantReport) {
+		t.Errorf("unexpected reportLocation = %# v; want = %# v", pretty.Formatter(context["reportLocation"]), pretty.Formatter(wantReport))
+	}
+	if !reflect.DeepEqual(got["sourceLocation"], wantSource) {
+		t.Errorf("unexpected sourceLocation = %# v; want = %# v", pretty.Formatter(got["sourceLocation"]), pretty.Formatter(wantSource))
+	}
+}
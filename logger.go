@@ -0,0 +1,16 @@
+package stackdriver
+
+import (
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NewLogger returns a logrus.Logger writing to w, which uses a Formatter
+// configured with options.
+func NewLogger(w io.Writer, options ...Option) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = w
+	logger.Formatter = NewFormatter(options...)
+	return logger
+}
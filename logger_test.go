@@ -0,0 +1,35 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := NewLogger(&out, WithService("test"))
+
+	f, ok := logger.Formatter.(*Formatter)
+	if !ok {
+		t.Fatalf("unexpected formatter = %T", logger.Formatter)
+	}
+	if want := "test"; f.Service != want {
+		t.Errorf("unexpected service = %v; want = %v", f.Service, want)
+	}
+
+	logger.Warn("my log entry")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "WARNING"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+	if want := "my log entry"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+}
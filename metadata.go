@@ -0,0 +1,60 @@
+package stackdriver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataTimeout limits how long looking up a value on the metadata server
+// may take, as it isn't reachable outside of GCP.
+const metadataTimeout = 500 * time.Millisecond
+
+// metadataCache holds the values looked up on the metadata server by URL,
+// including empty ones for values which couldn't be looked up.
+var metadataCache sync.Map
+
+// metadataValue returns the value at path on the metadata server, e.g.
+// "project/project-id", or an empty string if it couldn't be looked up.
+// Values are looked up once.
+func metadataValue(path string) string {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	url := "http://" + host + "/computeMetadata/v1/" + path
+
+	if v, ok := metadataCache.Load(url); ok {
+		return v.(string)
+	}
+	v := fetchMetadata(url)
+	metadataCache.Store(url, v)
+	return v
+}
+
+func fetchMetadata(url string) string {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := http.Client{Timeout: metadataTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,130 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOperation(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+	}{
+		{
+			name: "first",
+			fields: logrus.Fields{
+				DefaultOperationIdKey: "request-1",
+				"operationFirst":      true,
+			},
+			want: map[string]interface{}{
+				"id":    "request-1",
+				"first": true,
+			},
+		},
+		{
+			name: "last",
+			fields: logrus.Fields{
+				DefaultOperationIdKey: "request-1",
+				"operationLast":       "true",
+			},
+			want: map[string]interface{}{
+				"id":   "request-1",
+				"last": true,
+			},
+		},
+		{
+			name: "producer",
+			fields: logrus.Fields{
+				DefaultOperationIdKey: "request-1",
+				"operationProducer":   "github.com/connctd/api",
+			},
+			want: map[string]interface{}{
+				"id":       "request-1",
+				"producer": "github.com/connctd/api",
+			},
+		},
+		{
+			name: "none",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["operation"], tt.want) {
+				t.Errorf("unexpected operation = %# v; want = %# v", pretty.Formatter(got["operation"]), pretty.Formatter(tt.want))
+			}
+
+			context, _ := got["context"].(map[string]interface{})
+			if _, ok := context["data"]; ok {
+				t.Errorf("unexpected data = %# v", pretty.Formatter(context["data"]))
+			}
+		})
+	}
+}
+
+func TestOperationProducer(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+	}{
+		{
+			name: "static producer",
+			fields: logrus.Fields{
+				DefaultOperationIdKey: "request-1",
+			},
+			want: map[string]interface{}{
+				"id":       "request-1",
+				"producer": "test",
+			},
+		},
+		{
+			name: "entry producer",
+			fields: logrus.Fields{
+				DefaultOperationIdKey: "request-1",
+				"operationProducer":   "github.com/connctd/api",
+			},
+			want: map[string]interface{}{
+				"id":       "request-1",
+				"producer": "github.com/connctd/api",
+			},
+		},
+		{
+			name: "no operation id",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithOperationProducer("test"),
+			)
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["operation"], tt.want) {
+				t.Errorf("unexpected operation = %# v; want = %# v", pretty.Formatter(got["operation"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
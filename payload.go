@@ -0,0 +1,188 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultReservedKeyPrefix is the prefix of fields colliding with reserved keys.
+const DefaultReservedKeyPrefix = "field."
+
+// reservedKeys holds the keys used by the entry itself.
+var reservedKeys = entryKeys()
+
+func entryKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(entry{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// renameReservedKeys prefixes the keys of data which collide with reserved
+// keys, so they can't be mistaken for the entry's own.
+func renameReservedKeys(data map[string]interface{}, prefix string) {
+	// Renaming keys while ranging over data would depend on the order of
+	// iteration, so the keys are collected first.
+	var keys []string
+	for k := range data {
+		if reservedKeys[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := data[k]
+		delete(data, k)
+
+		// The prefixed key may be reserved or taken by another field as
+		// well, then it's prefixed once more.
+		key := prefix + k
+		for {
+			if _, ok := data[key]; !ok && !reservedKeys[key] {
+				break
+			}
+			key = prefix + key
+		}
+		data[key] = v
+	}
+}
+
+// replaceData replaces the fields of e with data, wherever they're serialized.
+func (e *entry) replaceData(data map[string]interface{}) {
+	if e.Payload != nil {
+		e.Payload = data
+		return
+	}
+	if e.Context == nil {
+		e.Context = &errorContext{}
+	}
+	e.Context.Data = data
+}
+
+// dropUnmarshalable returns a copy of m without the values, which can't be
+// marshaled as JSON.
+func dropUnmarshalable(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	kept := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if _, err := json.Marshal(v); err == nil {
+			kept[k] = v
+		}
+	}
+	return kept
+}
+
+// encodeEntry writes e along with its payload to buf as a single line of JSON.
+func encodeEntry(buf *bytes.Buffer, e *entry) error {
+	enc := json.NewEncoder(buf)
+	if err := enc.Encode(e); err != nil {
+		return err
+	}
+	if len(e.Payload) == 0 {
+		return nil
+	}
+
+	// Merge the payload into the entry by replacing the closing brace of the
+	// entry and the opening brace of the payload with a comma.
+	buf.Truncate(buf.Len() - len("}\n"))
+	empty := buf.Bytes()[buf.Len()-1] == '{'
+	mark := buf.Len()
+	if err := enc.Encode(e.Payload); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if empty {
+		copy(b[mark:], b[mark+1:])
+		buf.Truncate(len(b) - 1)
+	} else {
+		b[mark] = ','
+	}
+	return nil
+}
+
+// marshalEntry marshals e along with its payload using marshal, followed by a
+// newline.
+func marshalEntry(marshal func(interface{}) ([]byte, error), e *entry) ([]byte, error) {
+	b, err := marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(e.Payload) == 0 {
+		return append(b, '\n'), nil
+	}
+
+	p, err := marshal(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	p = bytes.TrimSpace(p)
+
+	// Merge both objects by joining their members.
+	out := make([]byte, 0, len(b)+len(p)+1)
+	out = append(out, b[:len(b)-1]...)
+	if len(b) > len("{}") {
+		out = append(out, ',')
+	}
+	out = append(out, p[1:]...)
+	return append(out, '\n'), nil
+}
+
+// renameKeys renames the top level keys of the JSON object b according to
+// keys. As the object is decoded, its members are sorted afterwards.
+func renameKeys(b []byte, keys map[string]string) ([]byte, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+
+	renamed := make(map[string]json.RawMessage, len(members))
+	for k, v := range members {
+		if key, ok := keys[k]; ok {
+			k = key
+		}
+		renamed[k] = v
+	}
+
+	out, err := json.Marshal(renamed)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// auditLog removes the auditLog field from data and returns it annotated with
+// the type of audit logs, or nil if there is none. The field is copied rather
+// than modified in place.
+func auditLog(data map[string]interface{}) map[string]interface{} {
+	var fields map[string]interface{}
+	switch v := data[fieldNameAuditLog].(type) {
+	case map[string]interface{}:
+		fields = v
+	case logrus.Fields:
+		fields = v
+	default:
+		return nil
+	}
+	delete(data, fieldNameAuditLog)
+
+	payload := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		payload[k] = v
+	}
+	payload["@type"] = auditLogType
+	return payload
+}
@@ -0,0 +1,405 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFlatPayload(t *testing.T) {
+	for _, tt := range []struct {
+		options []Option
+		want    map[string]interface{}
+	}{
+		{
+			options: []Option{WithFlatPayload()},
+			want: map[string]interface{}{
+				"severity":       "INFO",
+				"message":        "my log entry",
+				"foo":            "bar",
+				"field.severity": "high",
+			},
+		},
+		{
+			want: map[string]interface{}{
+				"severity": "INFO",
+				"message":  "my log entry",
+				"context": map[string]interface{}{
+					"data": map[string]interface{}{
+						"foo":            "bar",
+						"field.severity": "high",
+					},
+				},
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(tt.options...)
+
+		logger.
+			WithFields(logrus.Fields{
+				"foo":      "bar",
+				"severity": "high",
+			}).
+			Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+		delete(got, "sourceLocation")
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("unexpected output = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(tt.want))
+		}
+	}
+}
+
+func TestFlatPayloadError(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithFlatPayload())
+
+	logger.WithField("foo", "bar").Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if _, ok := got["foo"]; ok {
+		t.Errorf("unexpected top level field in output = %# v", pretty.Formatter(got))
+	}
+	if data := got["context"].(map[string]interface{})["data"]; !reflect.DeepEqual(data, map[string]interface{}{"foo": "bar"}) {
+		t.Errorf("unexpected data = %# v", pretty.Formatter(data))
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	for _, tt := range []struct {
+		options []Option
+		want    map[string]interface{}
+	}{
+		{
+			want: map[string]interface{}{
+				"severity": "INFO",
+				"message":  "my log entry",
+				"context": map[string]interface{}{
+					"data": map[string]interface{}{
+						"foo": "bar",
+					},
+				},
+			},
+		},
+		{
+			options: []Option{WithFlatPayload()},
+			want: map[string]interface{}{
+				"severity": "INFO",
+				"message":  "my log entry",
+				"foo":      "bar",
+			},
+		},
+	} {
+		var out bytes.Buffer
+		var calls int
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(append(tt.options, WithMarshaler(func(v interface{}) ([]byte, error) {
+			calls++
+			return json.Marshal(v)
+		}))...)
+
+		logger.WithField("foo", "bar").Info("my log entry")
+
+		if calls == 0 {
+			t.Errorf("marshaler not called")
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		delete(got, "sourceLocation")
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("unexpected output = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(tt.want))
+		}
+	}
+}
+
+func TestReservedKeyPrefix(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithReservedKeyPrefix("user."),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"severity":                     "high",
+			"timestamp":                    "yesterday",
+			"logging.googleapis.com/trace": 42,
+		}).
+		Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "ERROR"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+	if _, ok := got["logging.googleapis.com/trace"]; ok {
+		t.Errorf("unexpected trace = %v", got["logging.googleapis.com/trace"])
+	}
+
+	want := map[string]interface{}{
+		"user.severity":                     "high",
+		"user.timestamp":                    "yesterday",
+		"user.logging.googleapis.com/trace": 42.0,
+	}
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["data"], want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(want))
+	}
+}
+
+func TestRenameReservedKeysCollision(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		data := map[string]interface{}{
+			"message":         "reserved",
+			"field.message":   "taken",
+			"severity":        "high",
+			"field.severity":  "taken",
+			"field.field.foo": "unrelated",
+		}
+		renameReservedKeys(data, DefaultReservedKeyPrefix)
+
+		want := map[string]interface{}{
+			"field.field.message":  "reserved",
+			"field.message":        "taken",
+			"field.field.severity": "high",
+			"field.severity":       "taken",
+			"field.field.foo":      "unrelated",
+		}
+		if !reflect.DeepEqual(data, want) {
+			t.Fatalf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(want))
+		}
+	}
+}
+
+func TestFieldKeyMap(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithFieldKeyMap(map[string]string{
+			"message":  "msg",
+			"severity": "level",
+		}),
+	)
+
+	logger.WithField("foo", "bar").Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+	delete(got, "sourceLocation")
+
+	want := map[string]interface{}{
+		"level": "INFO",
+		"msg":   "my log entry",
+		"context": map[string]interface{}{
+			"data": map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(want))
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("}\n")) {
+		t.Errorf("unexpected output = %q", out.String())
+	}
+}
+
+func TestPretty(t *testing.T) {
+	for _, tt := range []struct {
+		options []Option
+		want    string
+	}{
+		{
+			options: []Option{WithPretty()},
+			want:    "{\n  \"message\": \"my log entry\",\n  \"severity\": \"INFO\"\n}\n",
+		},
+		{
+			want: "{\"message\":\"my log entry\",\"severity\":\"INFO\"}\n",
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(append(tt.options, WithoutSourceLocation())...)
+
+		logger.Info("my log entry")
+
+		if got := out.String(); got != tt.want {
+			t.Errorf("unexpected output = %q; want = %q", got, tt.want)
+		}
+	}
+}
+
+func TestTextPayloadForPlain(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		fields  logrus.Fields
+		level   logrus.Level
+		plain   bool
+	}{
+		{
+			name:  "plain",
+			level: logrus.InfoLevel,
+			plain: true,
+		},
+		{
+			name:   "fields",
+			fields: logrus.Fields{"foo": "bar"},
+			level:  logrus.InfoLevel,
+		},
+		{
+			name:  "error",
+			level: logrus.ErrorLevel,
+		},
+		{
+			name:    "service context",
+			options: []Option{WithService("test"), WithAlwaysServiceContext()},
+			level:   logrus.InfoLevel,
+		},
+		{
+			name:    "monitored resource",
+			options: []Option{WithMonitoredResource("global", nil)},
+			level:   logrus.InfoLevel,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(append(tt.options, WithTextPayloadForPlain())...)
+
+			logger.WithFields(tt.fields).Log(tt.level, "my log entry")
+
+			if tt.plain {
+				// The severity is lost in favor of the cheaper text payload.
+				if want := "my log entry\n"; out.String() != want {
+					t.Errorf("unexpected output = %q; want = %q", out.String(), want)
+				}
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("unexpected output = %q: %v", out.String(), err)
+			}
+			if want := "my log entry"; got["message"] != want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithAuditLog(),
+		WithoutSourceLocation(),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"foo": "bar",
+			"auditLog": map[string]interface{}{
+				"serviceName":  "example.googleapis.com",
+				"methodName":   "Delete",
+				"resourceName": "things/42",
+			},
+		}).
+		Info("thing deleted")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"@type":        "type.googleapis.com/google.cloud.audit.AuditLog",
+		"serviceName":  "example.googleapis.com",
+		"methodName":   "Delete",
+		"resourceName": "things/42",
+	}
+
+	if !reflect.DeepEqual(got["protoPayload"], want) {
+		t.Errorf("unexpected protoPayload = %# v; want = %# v", pretty.Formatter(got["protoPayload"]), pretty.Formatter(want))
+	}
+	if context := got["context"]; !reflect.DeepEqual(context, map[string]interface{}{"data": map[string]interface{}{"foo": "bar"}}) {
+		t.Errorf("unexpected context = %# v", pretty.Formatter(context))
+	}
+}
+
+func TestMessageField(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		data    func(map[string]interface{}) interface{}
+	}{
+		{
+			name: "context",
+			data: func(got map[string]interface{}) interface{} {
+				context, _ := got["context"].(map[string]interface{})
+				data, _ := context["data"].(map[string]interface{})
+				return data["field.message"]
+			},
+		},
+		{
+			name:    "flat payload",
+			options: []Option{WithFlatPayload()},
+			data: func(got map[string]interface{}) interface{} {
+				return got["field.message"]
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.WithField("message", "my field").Info("my log entry")
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "my log entry"; got["message"] != want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+			}
+			if want := "my field"; tt.data(got) != want {
+				t.Errorf("unexpected message field = %v; want = %v", tt.data(got), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package stackdriver
+
+import (
+	"os"
+)
+
+// WithAutoProjectID lets you configure the formatter to detect the project
+// id used to qualify trace ids. It is taken from the GOOGLE_CLOUD_PROJECT
+// environment variable or else looked up on the metadata server once, when
+// the option is applied. A project id configured with WithProjectID is kept.
+func WithAutoProjectID() Option {
+	return func(f *Formatter) {
+		if f.ProjectID == "" {
+			f.ProjectID = detectProjectID()
+		}
+	}
+}
+
+// detectProjectID returns the project id from the environment or the
+// metadata server, or an empty string if it couldn't be detected.
+func detectProjectID() string {
+	if projectID := os.Getenv("GOOGLE_CLOUD_PROJECT"); projectID != "" {
+		return projectID
+	}
+	return metadataValue("project/project-id")
+}
@@ -0,0 +1,129 @@
+package stackdriver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// RedactPattern replaces matches of Regexp in string values with Replacement.
+type RedactPattern struct {
+	Regexp      *regexp.Regexp
+	Replacement string
+}
+
+// redact replaces the values of redacted keys in data and masks matches of
+// the value patterns. Nested maps are copied before they're modified, as
+// they're usually shared between entries.
+func (f *Formatter) redact(data map[string]interface{}) {
+	if len(f.RedactValuePatterns) > 0 {
+		visiting := make(visitor)
+		for k, v := range data {
+			data[k] = f.redactValue(v, visiting)
+		}
+	}
+
+	if len(f.RedactKeys) == 0 {
+		return
+	}
+
+	for k := range data {
+		if f.isRedacted(k) {
+			data[k] = redacted
+		}
+	}
+
+	if req, ok := data["httpRequest"].(map[string]interface{}); ok {
+		data["httpRequest"] = f.redactHTTPRequest(req)
+	}
+
+	// The request may be nested in the context field as well, see
+	// liftHTTPRequest.
+	if context, ok := data["context"].(map[string]interface{}); ok {
+		if req, ok := context["httpRequest"].(map[string]interface{}); ok {
+			redactedContext := make(map[string]interface{}, len(context))
+			for k, v := range context {
+				redactedContext[k] = v
+			}
+			redactedContext["httpRequest"] = f.redactHTTPRequest(req)
+			data["context"] = redactedContext
+		}
+	}
+}
+
+// redactHTTPRequest returns a copy of req with the values of redacted keys
+// replaced.
+func (f *Formatter) redactHTTPRequest(req map[string]interface{}) map[string]interface{} {
+	redactedReq := make(map[string]interface{}, len(req))
+	for k, v := range req {
+		if f.isRedacted(k) {
+			v = redacted
+		}
+		redactedReq[k] = v
+	}
+	return redactedReq
+}
+
+func (f *Formatter) isRedacted(key string) bool {
+	for _, k := range f.RedactKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue applies the value patterns to v, descending into maps and
+// slices. Containers are copied rather than modified in place, those
+// referencing themselves are replaced by "[cyclic]".
+func (f *Formatter) redactValue(v interface{}, visiting visitor) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, logrus.Fields, []interface{}:
+		if !visiting.enter(v) {
+			return cyclic
+		}
+		defer visiting.leave(v)
+	}
+
+	switch v := v.(type) {
+	case string:
+		for _, p := range f.RedactValuePatterns {
+			v = p.Regexp.ReplaceAllString(v, p.Replacement)
+		}
+		return v
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for k, val := range v {
+			m[k] = f.redactValue(val, visiting).(string)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = f.redactValue(val, visiting)
+		}
+		return m
+	case logrus.Fields:
+		m := make(logrus.Fields, len(v))
+		for k, val := range v {
+			m[k] = f.redactValue(val, visiting)
+		}
+		return m
+	case []string:
+		s := make([]string, len(v))
+		for i, val := range v {
+			s[i] = f.redactValue(val, visiting).(string)
+		}
+		return s
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = f.redactValue(val, visiting)
+		}
+		return s
+	}
+	return v
+}
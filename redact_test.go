@@ -0,0 +1,132 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithRedactKeys("password", "authorization"),
+	)
+
+	req := map[string]interface{}{
+		"method":        "GET",
+		"Authorization": "Bearer secret",
+	}
+
+	logger.
+		WithFields(logrus.Fields{
+			"foo":         "bar",
+			"password":    "secret",
+			"Password":    "secret",
+			"httpRequest": req,
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"foo":      "bar",
+		"password": "[REDACTED]",
+		"Password": "[REDACTED]",
+	}
+	wantReq := map[string]interface{}{
+		"method":        "GET",
+		"Authorization": "[REDACTED]",
+	}
+
+	if data := got["context"].(map[string]interface{})["data"]; !reflect.DeepEqual(data, want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(want))
+	}
+	if gotReq := got["httpRequest"]; !reflect.DeepEqual(gotReq, wantReq) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(gotReq), pretty.Formatter(wantReq))
+	}
+	if req["Authorization"] != "Bearer secret" {
+		t.Errorf("unexpected modification of httpRequest = %# v", pretty.Formatter(req))
+	}
+}
+
+func TestRedactKeysNestedHTTPRequest(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithRedactKeys("authorization"),
+	)
+
+	req := map[string]interface{}{
+		"method":        "GET",
+		"Authorization": "Bearer secret",
+	}
+
+	logger.
+		WithField("context", map[string]interface{}{
+			"httpRequest": req,
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	wantReq := map[string]interface{}{
+		"method":        "GET",
+		"Authorization": "[REDACTED]",
+	}
+
+	if gotReq := got["httpRequest"]; !reflect.DeepEqual(gotReq, wantReq) {
+		t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(gotReq), pretty.Formatter(wantReq))
+	}
+	if req["Authorization"] != "Bearer secret" {
+		t.Errorf("unexpected modification of httpRequest = %# v", pretty.Formatter(req))
+	}
+}
+
+func TestRedactValuePattern(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithRedactValuePattern(regexp.MustCompile(`Bearer [A-Za-z0-9._-]+`), "Bearer [REDACTED]"),
+	)
+
+	logger.
+		WithFields(logrus.Fields{
+			"foo":    "bar",
+			"header": "Bearer abc.def-123",
+			"nested": map[string]interface{}{
+				"tokens": []interface{}{"Bearer abc", "none"},
+				"count":  2,
+			},
+		}).
+		Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"foo":    "bar",
+		"header": "Bearer [REDACTED]",
+		"nested": map[string]interface{}{
+			"tokens": []interface{}{"Bearer [REDACTED]", "none"},
+			"count":  2.0,
+		},
+	}
+
+	if data := got["context"].(map[string]interface{})["data"]; !reflect.DeepEqual(data, want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(want))
+	}
+}
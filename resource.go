@@ -0,0 +1,67 @@
+package stackdriver
+
+import (
+	"os"
+	"strings"
+)
+
+// WithAutoResource lets you configure the formatter to detect the monitored
+// resource it runs on, once when the option is applied. On GKE, it's a
+// k8s_container, on GCE a gce_instance. Values are taken from the environment
+// if set, e.g. POD_NAME and CONTAINER_NAME through the downward API, and
+// otherwise looked up on the metadata server. Outside of GCP, or if a
+// resource is configured with WithMonitoredResource, it has no effect.
+func WithAutoResource() Option {
+	return func(f *Formatter) {
+		if f.ResourceType != "" {
+			return
+		}
+		f.ResourceType, f.ResourceLabels = detectResource()
+	}
+}
+
+// detectResource returns the type and labels of the monitored resource, or
+// an empty type if it couldn't be detected.
+func detectResource() (string, map[string]string) {
+	projectID := detectProjectID()
+	if projectID == "" {
+		return "", nil
+	}
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		labels := map[string]string{
+			"project_id":     projectID,
+			"location":       envOrMetadata("CLUSTER_LOCATION", "instance/attributes/cluster-location"),
+			"cluster_name":   envOrMetadata("CLUSTER_NAME", "instance/attributes/cluster-name"),
+			"namespace_name": orDefault(os.Getenv("NAMESPACE_NAME"), os.Getenv("POD_NAMESPACE")),
+			"pod_name":       orDefault(os.Getenv("POD_NAME"), os.Getenv("HOSTNAME")),
+			"container_name": os.Getenv("CONTAINER_NAME"),
+		}
+		if labels["cluster_name"] == "" {
+			return "", nil
+		}
+		return "k8s_container", labels
+	}
+
+	instanceID := metadataValue("instance/id")
+	if instanceID == "" {
+		return "", nil
+	}
+	// The zone is of the form projects/PROJECT_NUMBER/zones/ZONE.
+	zone := metadataValue("instance/zone")
+	if i := strings.LastIndex(zone, "/"); i != -1 {
+		zone = zone[i+1:]
+	}
+	return "gce_instance", map[string]string{
+		"project_id":  projectID,
+		"instance_id": instanceID,
+		"zone":        zone,
+	}
+}
+
+func envOrMetadata(key, path string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return metadataValue(path)
+}
@@ -0,0 +1,165 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMonitoredResource(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithMonitoredResource("gce_instance", map[string]string{
+			"instance_id": "1234567890",
+			"zone":        "europe-west1-b",
+		}),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"type": "gce_instance",
+		"labels": map[string]interface{}{
+			"instance_id": "1234567890",
+			"zone":        "europe-west1-b",
+		},
+	}
+
+	if !reflect.DeepEqual(got["resource"], want) {
+		t.Errorf("unexpected resource = %# v; want = %# v", pretty.Formatter(got["resource"]), pretty.Formatter(want))
+	}
+}
+
+// setenv sets the environment variables in env for the duration of the test.
+func setenv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		prev, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestAutoResource(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("1234567890"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/123/zones/europe-west1-b"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer metadata.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	defer unreachable.Close()
+
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		options []Option
+		want    interface{}
+	}{
+		{
+			name: "gke",
+			env: map[string]string{
+				"GCE_METADATA_HOST":       unreachable.Listener.Addr().String(),
+				"GOOGLE_CLOUD_PROJECT":    "my-project",
+				"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+				"CLUSTER_LOCATION":        "europe-west1",
+				"CLUSTER_NAME":            "my-cluster",
+				"POD_NAMESPACE":           "default",
+				"POD_NAME":                "my-pod",
+				"CONTAINER_NAME":          "my-container",
+			},
+			want: map[string]interface{}{
+				"type": "k8s_container",
+				"labels": map[string]interface{}{
+					"project_id":     "my-project",
+					"location":       "europe-west1",
+					"cluster_name":   "my-cluster",
+					"namespace_name": "default",
+					"pod_name":       "my-pod",
+					"container_name": "my-container",
+				},
+			},
+		},
+		{
+			name: "gce",
+			env: map[string]string{
+				"GCE_METADATA_HOST":       metadata.Listener.Addr().String(),
+				"GOOGLE_CLOUD_PROJECT":    "my-project",
+				"KUBERNETES_SERVICE_HOST": "",
+			},
+			want: map[string]interface{}{
+				"type": "gce_instance",
+				"labels": map[string]interface{}{
+					"project_id":  "my-project",
+					"instance_id": "1234567890",
+					"zone":        "europe-west1-b",
+				},
+			},
+		},
+		{
+			name: "outside of gcp",
+			env: map[string]string{
+				"GCE_METADATA_HOST":       unreachable.Listener.Addr().String(),
+				"GOOGLE_CLOUD_PROJECT":    "",
+				"KUBERNETES_SERVICE_HOST": "",
+			},
+		},
+		{
+			name: "configured",
+			env: map[string]string{
+				"GCE_METADATA_HOST":       metadata.Listener.Addr().String(),
+				"GOOGLE_CLOUD_PROJECT":    "my-project",
+				"KUBERNETES_SERVICE_HOST": "",
+			},
+			options: []Option{WithMonitoredResource("global", nil)},
+			want: map[string]interface{}{
+				"type": "global",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, tt.env)
+
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(append(tt.options, WithAutoResource())...)
+
+			logger.Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["resource"], tt.want) {
+				t.Errorf("unexpected resource = %# v; want = %# v", pretty.Formatter(got["resource"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestServiceContext(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fmtr   *Formatter
+		modify func(*Formatter)
+		want   interface{}
+	}{
+		{
+			name: "unset",
+			fmtr: NewFormatter(),
+		},
+		{
+			name: "configured",
+			fmtr: NewFormatter(WithService("test"), WithVersion("0.1")),
+			want: map[string]interface{}{
+				"service": "test",
+				"version": "0.1",
+			},
+		},
+		{
+			name: "modified after construction",
+			fmtr: NewFormatter(WithService("test"), WithVersion("0.1")),
+			modify: func(f *Formatter) {
+				f.Version = "0.2"
+			},
+			want: map[string]interface{}{
+				"service": "test",
+				"version": "0.2",
+			},
+		},
+		{
+			name: "zero value formatter",
+			fmtr: &Formatter{Service: "test"},
+			want: map[string]interface{}{
+				"service": "test",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.modify != nil {
+				tt.modify(tt.fmtr)
+			}
+
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = tt.fmtr
+
+			logger.Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["serviceContext"], tt.want) {
+				t.Errorf("unexpected serviceContext = %# v; want = %# v", pretty.Formatter(got["serviceContext"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestSourceReference(t *testing.T) {
+	for _, tt := range []struct {
+		level logrus.Level
+		want  interface{}
+	}{
+		{
+			level: logrus.ErrorLevel,
+			want: []interface{}{
+				map[string]interface{}{
+					"repository": "https://github.com/connctd/logrus-stackdriver-formatter",
+					"revisionId": "0123456789abcdef",
+				},
+			},
+		},
+		{
+			level: logrus.InfoLevel,
+		},
+	} {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithSourceReference("https://github.com/connctd/logrus-stackdriver-formatter", "0123456789abcdef"),
+			)
+
+			logger.Log(tt.level, "my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["sourceReferences"], tt.want) {
+				t.Errorf("unexpected sourceReferences = %# v; want = %# v", pretty.Formatter(context["sourceReferences"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestAlwaysServiceContext(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    interface{}
+	}{
+		{
+			name:    "default",
+			options: []Option{WithService("test"), WithVersion("0.1")},
+		},
+		{
+			name:    "always",
+			options: []Option{WithService("test"), WithVersion("0.1"), WithAlwaysServiceContext()},
+			want: map[string]interface{}{
+				"service": "test",
+				"version": "0.1",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["serviceContext"], tt.want) {
+				t.Errorf("unexpected serviceContext = %# v; want = %# v", pretty.Formatter(got["serviceContext"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestServiceContextOverride(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   interface{}
+		data   interface{}
+	}{
+		{
+			name: "absent",
+			fields: logrus.Fields{
+				"foo": "bar",
+			},
+			want: map[string]interface{}{
+				"service": "test",
+				"version": "0.1",
+			},
+			data: map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+		{
+			name: "service and version",
+			fields: logrus.Fields{
+				"serviceName":    "other",
+				"serviceVersion": "0.2",
+			},
+			want: map[string]interface{}{
+				"service": "other",
+				"version": "0.2",
+			},
+		},
+		{
+			name: "service only",
+			fields: logrus.Fields{
+				"serviceName": "other",
+			},
+			want: map[string]interface{}{
+				"service": "other",
+				"version": "0.1",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(WithService("test"), WithVersion("0.1"))
+
+			logger.WithFields(tt.fields).Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if !reflect.DeepEqual(got["serviceContext"], tt.want) {
+				t.Errorf("unexpected serviceContext = %# v; want = %# v", pretty.Formatter(got["serviceContext"]), pretty.Formatter(tt.want))
+			}
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSeverityMap(t *testing.T) {
+	for _, tt := range []struct {
+		level logrus.Level
+		want  string
+	}{
+		{logrus.InfoLevel, "INFO"},
+		{logrus.WarnLevel, "ERROR"},
+		{logrus.ErrorLevel, "ERROR"},
+		{logrus.DebugLevel, "DEBUG"},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Level = logrus.DebugLevel
+		logger.Formatter = NewFormatter(
+			WithSeverityMap(map[logrus.Level]string{
+				logrus.WarnLevel:  "ERROR",
+				logrus.DebugLevel: "VERBOSE",
+			}),
+		)
+
+		logger.Log(tt.level, "my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["severity"] != tt.want {
+			t.Errorf("unexpected severity for %s = %v; want = %v", tt.level, got["severity"], tt.want)
+		}
+	}
+}
+
+func TestSeverityNotice(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithSeverityMap(map[logrus.Level]string{
+			logrus.InfoLevel:  "NOTICE",
+			logrus.PanicLevel: "EMERGENCY",
+		}),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "NOTICE"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+	if want := severityEmergency; logger.Formatter.(*Formatter).severity(logrus.PanicLevel) != want {
+		t.Errorf("unexpected severity = %v; want = %v", logger.Formatter.(*Formatter).severity(logrus.PanicLevel), want)
+	}
+}
+
+func TestDefaultSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{
+			name: "default",
+			want: "DEFAULT",
+		},
+		{
+			name:    "configured",
+			options: []Option{WithDefaultSeverity("NOTICE")},
+			want:    "NOTICE",
+		},
+		{
+			name:    "unknown severity",
+			options: []Option{WithDefaultSeverity("VERBOSE")},
+			want:    "DEFAULT",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := logrus.NewEntry(logrus.New())
+			e.Message = "my log entry"
+			e.Level = logrus.Level(42)
+
+			b, err := NewFormatter(tt.options...).Format(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got map[string]interface{}
+			json.Unmarshal(b, &got)
+
+			if got["severity"] != tt.want {
+				t.Errorf("unexpected severity = %v; want = %v", got["severity"], tt.want)
+			}
+		})
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(
+		WithMinSeverity(logrus.InfoLevel),
+	)
+
+	logger.Debug("my debug entry")
+	if out.Len() != 0 {
+		t.Errorf("unexpected output = %s", out.String())
+	}
+
+	logger.Info("my info entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "my info entry"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+}
+
+func TestSeverityOverride(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		options  []Option
+		fields   logrus.Fields
+		severity string
+		data     interface{}
+	}{
+		{
+			name:     "valid",
+			fields:   logrus.Fields{"severity": "NOTICE"},
+			severity: "NOTICE",
+		},
+		{
+			name:     "invalid",
+			fields:   logrus.Fields{"severity": "high"},
+			severity: "INFO",
+			data:     map[string]interface{}{"field.severity": "high"},
+		},
+		{
+			name:     "custom key",
+			options:  []Option{WithSeverityKey("level")},
+			fields:   logrus.Fields{"level": "WARNING"},
+			severity: "WARNING",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.WithFields(tt.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["severity"] != tt.severity {
+				t.Errorf("unexpected severity = %v; want = %v", got["severity"], tt.severity)
+			}
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["data"], tt.data) {
+				t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(context["data"]), pretty.Formatter(tt.data))
+			}
+		})
+	}
+}
+
+func TestSeverityFor(t *testing.T) {
+	f := NewFormatter(
+		WithSeverityMap(map[logrus.Level]string{
+			logrus.InfoLevel: "NOTICE",
+		}),
+		WithDefaultSeverity("INFO"),
+	)
+
+	for _, tt := range []struct {
+		level logrus.Level
+		want  string
+	}{
+		{logrus.InfoLevel, "NOTICE"},
+		{logrus.WarnLevel, "WARNING"},
+		{logrus.Level(42), "INFO"},
+	} {
+		if got := f.SeverityFor(tt.level); got != tt.want {
+			t.Errorf("unexpected severity for %s = %v; want = %v", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMaxEntryBytes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		path    []string
+	}{
+		{
+			name: "context",
+			path: []string{"context", "data"},
+		},
+		{
+			name:    "flat payload",
+			options: []Option{WithFlatPayload()},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const limit = 64 * 1024
+
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(append(tt.options, WithMaxEntryBytes(limit))...)
+
+			logger.WithField("foo", strings.Repeat("x", 1024*1024)).Info("my log entry")
+
+			if out.Len() > limit {
+				t.Errorf("unexpected entry size = %d; want <= %d", out.Len(), limit)
+			}
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			data := got
+			for _, key := range tt.path {
+				data, _ = data[key].(map[string]interface{})
+			}
+
+			if _, ok := data["foo"]; ok {
+				t.Errorf("unexpected field foo")
+			}
+			if want := true; data["_truncated"] != want {
+				t.Errorf("unexpected _truncated = %# v; want = %# v", pretty.Formatter(data["_truncated"]), want)
+			}
+			if want := "my log entry"; got["message"] != want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+			}
+		})
+	}
+}
+
+func TestMarshalError(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithField("foo", make(chan int)).Warn("my log entry")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected output = %s: %v", out.String(), err)
+	}
+
+	if want := "my log entry"; got["message"] != want {
+		t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+	}
+	if want := "WARNING"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	data, _ := context["data"].(map[string]interface{})
+	if _, ok := data["_marshalError"].(string); !ok {
+		t.Errorf("unexpected data = %# v", pretty.Formatter(data))
+	}
+}
+
+func TestMarshalErrorHTTPRequest(t *testing.T) {
+	for _, level := range []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel} {
+		t.Run(level.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter()
+
+			logger.
+				WithField("httpRequest", map[string]interface{}{
+					"requestMethod": "GET",
+					"foo":           make(chan int),
+				}).
+				Log(level, "my log entry")
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("unexpected output = %s: %v", out.String(), err)
+			}
+
+			if want := "my log entry"; got["message"] != want {
+				t.Errorf("unexpected message = %v; want = %v", got["message"], want)
+			}
+
+			req, _ := got["httpRequest"].(map[string]interface{})
+			context, _ := got["context"].(map[string]interface{})
+			if req == nil {
+				req, _ = context["httpRequest"].(map[string]interface{})
+			}
+			want := map[string]interface{}{"requestMethod": "GET"}
+			if !reflect.DeepEqual(req, want) {
+				t.Errorf("unexpected httpRequest = %# v; want = %# v", pretty.Formatter(req), pretty.Formatter(want))
+			}
+			data, _ := context["data"].(map[string]interface{})
+			if _, ok := data["_marshalError"].(string); !ok {
+				t.Errorf("unexpected data = %# v", pretty.Formatter(data))
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"reflect"
+	"regexp"
 	"testing"
 
 	"github.com/connctd/logrus-stackdriver-formatter/test"
@@ -41,13 +42,165 @@ func TestStackSkip(t *testing.T) {
 		"context": map[string]interface{}{
 			"reportLocation": map[string]interface{}{
 				"filePath":     "github.com/connctd/logrus-stackdriver-formatter/stackskip_test.go",
-				"lineNumber":   29.0,
+				"lineNumber":   30.0,
 				"functionName": "TestStackSkip",
 			},
 		},
+		"sourceLocation": map[string]interface{}{
+			"file":     "github.com/connctd/logrus-stackdriver-formatter/stackskip_test.go",
+			"line":     "30",
+			"function": "TestStackSkip",
+		},
 	}
 
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("unexpected output = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(want))
 	}
 }
+
+func TestStackSkipPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		prefix string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "matching prefix",
+			prefix: "github.com/connctd/logrus-stackdriver-formatter/te",
+			want: map[string]interface{}{
+				"filePath":     "github.com/connctd/logrus-stackdriver-formatter/stackskip_test.go",
+				"lineNumber":   99.0,
+				"functionName": "TestStackSkipPrefix.func1",
+			},
+		},
+		{
+			name:   "unrelated prefix",
+			prefix: "github.com/connctd/other",
+			want: map[string]interface{}{
+				"filePath":     "github.com/connctd/logrus-stackdriver-formatter/test/logger.go",
+				"lineNumber":   10.0,
+				"functionName": "(*LogWrapper).Error",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithStackSkipPrefix(tt.prefix),
+			)
+
+			mylog := test.LogWrapper{
+				Logger: logger,
+			}
+
+			mylog.Error("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			context, _ := got["context"].(map[string]interface{})
+			if !reflect.DeepEqual(context["reportLocation"], tt.want) {
+				t.Errorf("unexpected reportLocation = %# v; want = %# v", pretty.Formatter(context["reportLocation"]), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
+
+func TestStackSkipRegexp(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithStackSkipRegexp(regexp.MustCompile(`^github\.com/connctd/logrus-stackdriver-formatter/(test|internal)$`)),
+	)
+
+	mylog := test.LogWrapper{
+		Logger: logger,
+	}
+
+	mylog.Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"filePath":     "github.com/connctd/logrus-stackdriver-formatter/stackskip_test.go",
+		"lineNumber":   125.0,
+		"functionName": "TestStackSkipRegexp",
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	if !reflect.DeepEqual(context["reportLocation"], want) {
+		t.Errorf("unexpected reportLocation = %# v; want = %# v", pretty.Formatter(context["reportLocation"]), pretty.Formatter(want))
+	}
+}
+
+func TestStackSkipAll(t *testing.T) {
+	for _, level := range []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel} {
+		t.Run(level.String(), func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithStackSkipRegexp(regexp.MustCompile(`.`)),
+			)
+
+			logger.Log(level, "my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if _, ok := got["sourceLocation"]; ok {
+				t.Errorf("unexpected sourceLocation = %# v", pretty.Formatter(got["sourceLocation"]))
+			}
+			if _, ok := got["context"]; ok {
+				t.Errorf("unexpected context = %# v", pretty.Formatter(got["context"]))
+			}
+		})
+	}
+}
+
+func TestStackSkipReportCaller(t *testing.T) {
+	var out, hook bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithStackSkip("github.com/connctd/logrus-stackdriver-formatter/test"),
+	)
+	logger.SetReportCaller(true)
+	logger.AddHook(NewSplitHook(&hook, &hook, logrus.ErrorLevel))
+
+	mylog := test.LogWrapper{
+		Logger: logger,
+	}
+
+	mylog.Error("my log entry")
+
+	want := map[string]interface{}{
+		"filePath":     "github.com/connctd/logrus-stackdriver-formatter/stackskip_test.go",
+		"lineNumber":   183.0,
+		"functionName": "TestStackSkipReportCaller",
+	}
+
+	for _, tt := range []struct {
+		name string
+		out  *bytes.Buffer
+	}{
+		{"logger", &out},
+		{"hook", &hook},
+	} {
+		var got map[string]interface{}
+		json.Unmarshal(tt.out.Bytes(), &got)
+
+		context, _ := got["context"].(map[string]interface{})
+		if !reflect.DeepEqual(context["reportLocation"], want) {
+			t.Errorf("unexpected reportLocation on %s = %# v; want = %# v", tt.name, pretty.Formatter(context["reportLocation"]), pretty.Formatter(want))
+		}
+	}
+}
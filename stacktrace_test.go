@@ -0,0 +1,137 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStackTrace(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithStackTrace())
+
+	logger.WithError(errors.New("test error")).Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	msg, _ := got["message"].(string)
+
+	if want := "my log entry: test error\n\ngoroutine "; !strings.HasPrefix(msg, want) {
+		t.Errorf("unexpected message = %q; want prefix = %q", msg, want)
+	}
+	if want := "github.com/connctd/logrus-stackdriver-formatter.TestStackTrace(...)\n\t"; !strings.Contains(msg, want) {
+		t.Errorf("unexpected message = %q; want to contain = %q", msg, want)
+	}
+	if strings.Contains(msg, "github.com/sirupsen/logrus.") {
+		t.Errorf("unexpected logrus frames in message = %q", msg)
+	}
+}
+
+func TestStackTraceWithoutError(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithStackTrace())
+
+	logger.Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "my log entry"; got["message"] != want {
+		t.Errorf("unexpected message = %q; want = %q", got["message"], want)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		function string
+	}{
+		{
+			err:      newStackError(),
+			function: "newStackError",
+		},
+		{
+			err:      fmt.Errorf("wrapped: %w", pkgerrors.Wrap(newStackError(), "context")),
+			function: "newStackError",
+		},
+		{
+			err:      errors.New("test error"),
+			function: "TestErrorStack",
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(WithStackTrace())
+
+		logger.WithError(tt.err).Error("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		location := got["context"].(map[string]interface{})["reportLocation"].(map[string]interface{})
+		if location["functionName"] != tt.function {
+			t.Errorf("unexpected function = %v; want = %v", location["functionName"], tt.function)
+		}
+		if want := "github.com/connctd/logrus-stackdriver-formatter/stacktrace_test.go"; location["filePath"] != want {
+			t.Errorf("unexpected file path = %v; want = %v", location["filePath"], want)
+		}
+
+		msg, _ := got["message"].(string)
+		if want := "github.com/connctd/logrus-stackdriver-formatter." + tt.function + "(...)\n\t"; !strings.Contains(msg, want) {
+			t.Errorf("unexpected message = %q; want to contain = %q", msg, want)
+		}
+	}
+}
+
+func newStackError() error {
+	return pkgerrors.New("test error")
+}
+
+func TestStackField(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithStackField("stack"))
+
+	logger.WithField("captureStack", true).Warn("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if want := "WARNING"; got["severity"] != want {
+		t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+	}
+
+	context, _ := got["context"].(map[string]interface{})
+	data, _ := context["data"].(map[string]interface{})
+	stack, _ := data["stack"].(string)
+
+	if want := "goroutine "; !strings.HasPrefix(stack, want) {
+		t.Errorf("unexpected stack = %q; want prefix = %q", stack, want)
+	}
+	if want := "github.com/connctd/logrus-stackdriver-formatter.TestStackField(...)\n\t"; !strings.Contains(stack, want) {
+		t.Errorf("unexpected stack = %q; want to contain = %q", stack, want)
+	}
+	if strings.Contains(stack, "github.com/sirupsen/logrus.") {
+		t.Errorf("unexpected logrus frames in stack = %q", stack)
+	}
+	if _, ok := data["captureStack"]; ok {
+		t.Errorf("unexpected captureStack field = %v", data["captureStack"])
+	}
+}
@@ -0,0 +1,95 @@
+package stackdriver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// qualifyTrace turns a bare trace id into the projects/PROJECT_ID/traces/TRACE_ID
+// form expected by Cloud Logging, if a project id is configured.
+func (f *Formatter) qualifyTrace(traceID string) string {
+	if traceID == "" || f.ProjectID == "" || strings.HasPrefix(traceID, "projects/") {
+		return traceID
+	}
+	return fmt.Sprintf("projects/%s/traces/%s", f.ProjectID, traceID)
+}
+
+// normalizeTraceID converts a decimal trace id into its 32 hex characters
+// form. Other trace ids are returned unchanged.
+func normalizeTraceID(traceID string) string {
+	n, err := strconv.ParseUint(traceID, 10, 64)
+	if err != nil {
+		return traceID
+	}
+	return fmt.Sprintf("%032x", n)
+}
+
+// parseTraceParent extracts the trace id, span id and sampled flag from a W3C
+// traceparent value of the form "00-<trace-id>-<span-id>-<flags>".
+func parseTraceParent(v string) (traceID, spanID string, sampled, ok bool) {
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 {
+		return "", "", false, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	// Version ff is forbidden, version 00 has exactly four parts.
+	if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", false, false
+	}
+	if !isHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return "", "", false, false
+	}
+	if !isHex(spanID, 16) || spanID == strings.Repeat("0", 16) {
+		return "", "", false, false
+	}
+	if !isHex(flags, 2) {
+		return "", "", false, false
+	}
+	b, _ := hex.DecodeString(flags)
+	return traceID, spanID, b[0]&0x01 == 0x01, true
+}
+
+// parseCloudTraceContext extracts the trace id, span id and sampled flag from
+// an X-Cloud-Trace-Context value of the form "<trace-id>/<span-id>;o=<flag>",
+// where the span id and the options are optional. The span id is decimal and
+// gets converted to the hex form used by Cloud Logging.
+func parseCloudTraceContext(v string) (traceID, spanID string, sampled, ok bool) {
+	traceID, options := v, ""
+	if i := strings.IndexByte(v, ';'); i != -1 {
+		traceID, options = v[:i], v[i+1:]
+	}
+	if i := strings.IndexByte(traceID, '/'); i != -1 {
+		traceID, spanID = traceID[:i], traceID[i+1:]
+	}
+
+	if !isHex(traceID, 32) {
+		return "", "", false, false
+	}
+	if spanID != "" {
+		n, err := strconv.ParseUint(spanID, 10, 64)
+		if err != nil {
+			return "", "", false, false
+		}
+		spanID = fmt.Sprintf("%016x", n)
+	}
+	switch options {
+	case "", "o=0":
+	case "o=1":
+		sampled = true
+	default:
+		return "", "", false, false
+	}
+	return traceID, spanID, sampled, true
+}
+
+// isHex reports whether s consists of n lowercase hex characters.
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,345 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTraceParent(t *testing.T) {
+	for _, tt := range []struct {
+		traceParent string
+		trace       interface{}
+		spanID      interface{}
+		data        interface{}
+	}{
+		{
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			trace:       "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:      "00f067aa0ba902b7",
+		},
+		{
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-not-a-span-01",
+			data: map[string]interface{}{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-not-a-span-01",
+			},
+		},
+		{
+			traceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			data: map[string]interface{}{
+				"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter()
+
+		logger.WithField("traceparent", tt.traceParent).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/trace"] != tt.trace {
+			t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], tt.trace)
+		}
+		if got["logging.googleapis.com/span_id"] != tt.spanID {
+			t.Errorf("unexpected span id = %v; want = %v", got["logging.googleapis.com/span_id"], tt.spanID)
+		}
+		context, _ := got["context"].(map[string]interface{})
+		if data := context["data"]; !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(tt.data))
+		}
+	}
+}
+
+func TestProjectID(t *testing.T) {
+	for _, tt := range []struct {
+		projectID string
+		traceID   string
+		want      string
+	}{
+		{
+			projectID: "my-project",
+			traceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+			want:      "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			projectID: "my-project",
+			traceID:   "projects/other-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			want:      "projects/other-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			want:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(WithProjectID(tt.projectID))
+
+		logger.WithField(fieldNameTraceID, tt.traceID).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/trace"] != tt.want {
+			t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], tt.want)
+		}
+	}
+}
+
+func TestTraceSampled(t *testing.T) {
+	for _, tt := range []struct {
+		fields logrus.Fields
+		want   interface{}
+	}{
+		{
+			fields: logrus.Fields{
+				fieldNameTraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+				fieldNameTraceSampled: true,
+			},
+			want: true,
+		},
+		{
+			fields: logrus.Fields{
+				fieldNameTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				fieldNameSampled: "true",
+			},
+			want: true,
+		},
+		{
+			fields: logrus.Fields{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			want: true,
+		},
+		{
+			fields: logrus.Fields{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			},
+		},
+		{
+			fields: logrus.Fields{
+				fieldNameTraceSampled: true,
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter()
+
+		logger.WithFields(tt.fields).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/trace_sampled"] != tt.want {
+			t.Errorf("unexpected trace sampled = %v; want = %v", got["logging.googleapis.com/trace_sampled"], tt.want)
+		}
+	}
+}
+
+type spanContextKey struct{}
+
+type spanContext struct {
+	traceID string
+	spanID  string
+	sampled bool
+}
+
+func TestSpanContextExtractor(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithSpanContextExtractor(func(ctx context.Context) (string, string, bool) {
+			sc, _ := ctx.Value(spanContextKey{}).(spanContext)
+			return sc.traceID, sc.spanID, sc.sampled
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), spanContextKey{}, spanContext{
+		traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		spanID:  "00f067aa0ba902b7",
+		sampled: true,
+	})
+
+	logger.WithContext(ctx).Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"logging.googleapis.com/trace":         "4bf92f3577b34da6a3ce929d0e0e4736",
+		"logging.googleapis.com/span_id":       "00f067aa0ba902b7",
+		"logging.googleapis.com/trace_sampled": true,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("unexpected %s = %v; want = %v", k, got[k], v)
+		}
+	}
+}
+
+func TestNormalizeTraceID(t *testing.T) {
+	for _, tt := range []struct {
+		traceID string
+		want    string
+	}{
+		{
+			traceID: "5208512171318403364",
+			want:    "000000000000000048485a3953bb6124",
+		},
+		{
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			want:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(
+			WithNormalizeTraceID(),
+		)
+
+		logger.WithField(fieldNameTraceID, tt.traceID).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/trace"] != tt.want {
+			t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], tt.want)
+		}
+	}
+}
+
+func TestCloudTraceContext(t *testing.T) {
+	for _, tt := range []struct {
+		traceContext string
+		trace        interface{}
+		spanID       interface{}
+		sampled      interface{}
+		data         interface{}
+	}{
+		{
+			traceContext: "4bf92f3577b34da6a3ce929d0e0e4736/12345;o=1",
+			trace:        "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:       "0000000000003039",
+			sampled:      true,
+		},
+		{
+			traceContext: "4bf92f3577b34da6a3ce929d0e0e4736",
+			trace:        "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			traceContext: "not-a-trace/12345;o=1",
+			data: map[string]interface{}{
+				"X-Cloud-Trace-Context": "not-a-trace/12345;o=1",
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter()
+
+		logger.WithField("X-Cloud-Trace-Context", tt.traceContext).Info("my log entry")
+
+		var got map[string]interface{}
+		json.Unmarshal(out.Bytes(), &got)
+
+		if got["logging.googleapis.com/trace"] != tt.trace {
+			t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], tt.trace)
+		}
+		if got["logging.googleapis.com/span_id"] != tt.spanID {
+			t.Errorf("unexpected span id = %v; want = %v", got["logging.googleapis.com/span_id"], tt.spanID)
+		}
+		if got["logging.googleapis.com/trace_sampled"] != tt.sampled {
+			t.Errorf("unexpected sampled = %v; want = %v", got["logging.googleapis.com/trace_sampled"], tt.sampled)
+		}
+		context, _ := got["context"].(map[string]interface{})
+		if data := context["data"]; !reflect.DeepEqual(data, tt.data) {
+			t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(tt.data))
+		}
+	}
+}
+
+func TestSpanIDWithoutTrace(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithField(fieldNameSpanID, "00f067aa0ba902b7").Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	if _, ok := got["logging.googleapis.com/span_id"]; ok {
+		t.Errorf("unexpected span id = %v", got["logging.googleapis.com/span_id"])
+	}
+
+	want := map[string]interface{}{
+		fieldNameSpanID: "00f067aa0ba902b7",
+	}
+	context, _ := got["context"].(map[string]interface{})
+	if data := context["data"]; !reflect.DeepEqual(data, want) {
+		t.Errorf("unexpected data = %# v; want = %# v", pretty.Formatter(data), pretty.Formatter(want))
+	}
+}
+
+func TestAutoProjectID(t *testing.T) {
+	setenv(t, map[string]string{
+		"GOOGLE_CLOUD_PROJECT": "my-project",
+	})
+
+	for _, tt := range []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{
+			name:    "detected",
+			options: []Option{WithAutoProjectID()},
+			want:    "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:    "configured",
+			options: []Option{WithProjectID("other-project"), WithAutoProjectID()},
+			want:    "projects/other-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(tt.options...)
+
+			logger.WithField(fieldNameTraceID, "4bf92f3577b34da6a3ce929d0e0e4736").Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			if got["logging.googleapis.com/trace"] != tt.want {
+				t.Errorf("unexpected trace = %v; want = %v", got["logging.googleapis.com/trace"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package stackdriver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Validate reports fields of e, which Format can't map to the fields Cloud
+// Logging expects, e.g. an httpRequest field which isn't a map or a trace id
+// which isn't hex. It produces no output, so it can be used in tests to catch
+// logging mistakes early.
+func (f *Formatter) Validate(e *logrus.Entry) []string {
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if req, ok := e.Data["httpRequest"]; ok {
+		if _, ok := req.(map[string]interface{}); !ok {
+			warnf("httpRequest: expected map[string]interface{}, got %T", req)
+		}
+	}
+
+	severityKey := orDefault(f.SeverityKey, fieldNameSeverity)
+	if _, ok := e.Data[severityKey]; ok {
+		if _, ok := parseSeverity(getStringValue(severityKey, e.Data)); !ok {
+			warnf("%s: unknown severity %v", severityKey, e.Data[severityKey])
+		}
+	}
+
+	traceIDKey := orDefault(f.TraceIDKey, fieldNameTraceID)
+	if traceID := getStringValue(traceIDKey, e.Data); traceID != "" {
+		if f.NormalizeTraceID {
+			traceID = normalizeTraceID(traceID)
+		}
+		if i := strings.LastIndex(traceID, "/traces/"); i != -1 && strings.HasPrefix(traceID, "projects/") {
+			traceID = traceID[i+len("/traces/"):]
+		}
+		if !isHex(traceID, 32) {
+			warnf("%s: expected 32 lowercase hex characters, got %q", traceIDKey, traceID)
+		}
+	}
+
+	spanIDKey := orDefault(f.SpanIDKey, fieldNameSpanID)
+	if spanID := getStringValue(spanIDKey, e.Data); spanID != "" && !isHex(spanID, 16) {
+		warnf("%s: expected 16 lowercase hex characters, got %q", spanIDKey, spanID)
+	}
+
+	if traceParent := getStringValue(fieldNameTraceParent, e.Data); traceParent != "" {
+		if _, _, _, ok := parseTraceParent(traceParent); !ok {
+			warnf("%s: malformed value %q", fieldNameTraceParent, traceParent)
+		}
+	}
+
+	cloudTraceContextKey := orDefault(f.CloudTraceContextKey, fieldNameCloudTraceContext)
+	if traceContext := getStringValue(cloudTraceContextKey, e.Data); traceContext != "" {
+		if _, _, _, ok := parseCloudTraceContext(traceContext); !ok {
+			warnf("%s: malformed value %q", cloudTraceContextKey, traceContext)
+		}
+	}
+
+	return warnings
+}
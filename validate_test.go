@@ -0,0 +1,71 @@
+package stackdriver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fields logrus.Fields
+		want   []string
+	}{
+		{
+			name: "valid",
+			fields: logrus.Fields{
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+				},
+				fieldNameTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				fieldNameSpanID:  "00f067aa0ba902b7",
+			},
+		},
+		{
+			name: "malformed httpRequest",
+			fields: logrus.Fields{
+				"httpRequest": "GET /",
+			},
+			want: []string{
+				"httpRequest: expected map[string]interface{}, got string",
+			},
+		},
+		{
+			name: "bad trace id",
+			fields: logrus.Fields{
+				fieldNameTraceID: "not-a-trace",
+			},
+			want: []string{
+				`ot-tracer-traceid: expected 32 lowercase hex characters, got "not-a-trace"`,
+			},
+		},
+		{
+			name: "qualified trace id",
+			fields: logrus.Fields{
+				fieldNameTraceID: "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+		},
+		{
+			name: "bad traceparent",
+			fields: logrus.Fields{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+			want: []string{
+				`traceparent: malformed value "00-4bf92f3577b34da6a3ce929d0e0e4736"`,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := logrus.NewEntry(logrus.New()).WithFields(tt.fields)
+
+			got := NewFormatter().Validate(e)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected warnings = %# v; want = %# v", pretty.Formatter(got), pretty.Formatter(tt.want))
+			}
+		})
+	}
+}
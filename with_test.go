@@ -0,0 +1,88 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWith(t *testing.T) {
+	base := NewFormatter(
+		WithService("test"),
+		WithLabels(map[string]string{"env": "test"}),
+	)
+
+	derived := base.With(
+		WithLabels(map[string]string{"request": "request-1"}),
+		WithStackSkip("github.com/connctd/logrus-stackdriver-formatter/test"),
+	)
+
+	if want := map[string]string{"env": "test"}; !reflect.DeepEqual(base.Labels, want) {
+		t.Errorf("unexpected base labels = %# v; want = %# v", pretty.Formatter(base.Labels), pretty.Formatter(want))
+	}
+	if want := []string{"github.com/sirupsen/logrus"}; !reflect.DeepEqual(base.StackSkip, want) {
+		t.Errorf("unexpected base stack skip = %v; want = %v", base.StackSkip, want)
+	}
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = derived
+
+	logger.Error("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	want := map[string]interface{}{
+		"env":     "test",
+		"request": "request-1",
+	}
+	if !reflect.DeepEqual(got["logging.googleapis.com/labels"], want) {
+		t.Errorf("unexpected labels = %# v; want = %# v", pretty.Formatter(got["logging.googleapis.com/labels"]), pretty.Formatter(want))
+	}
+	if want := map[string]interface{}{"service": "test"}; !reflect.DeepEqual(got["serviceContext"], want) {
+		t.Errorf("unexpected serviceContext = %# v; want = %# v", pretty.Formatter(got["serviceContext"]), pretty.Formatter(want))
+	}
+}
+
+func TestWithConcurrent(t *testing.T) {
+	base := NewFormatter(
+		WithLabels(map[string]string{"env": "test"}),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = base.With(
+				WithLabels(map[string]string{"request": fmt.Sprint(i)}),
+				WithRedactKeys("password"),
+			)
+
+			logger.Info("my log entry")
+
+			var got map[string]interface{}
+			json.Unmarshal(out.Bytes(), &got)
+
+			labels, _ := got["logging.googleapis.com/labels"].(map[string]interface{})
+			if labels["request"] != fmt.Sprint(i) {
+				t.Errorf("unexpected request label = %v; want = %v", labels["request"], i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
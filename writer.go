@@ -0,0 +1,70 @@
+package stackdriver
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+type lineWriter struct {
+	f     *Formatter
+	level logrus.Level
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Writer returns an io.Writer, which formats every line written to it as an
+// entry of the given level and writes it to w. Use it to bridge libraries
+// which only log plain text, e.g. with log.SetOutput.
+func (f *Formatter) Writer(w io.Writer, level logrus.Level) io.Writer {
+	return &lineWriter{
+		f:     f,
+		level: level,
+		w:     w,
+	}
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	// Walking the stack from Format would locate this writer, so the caller
+	// is resolved here, skipping the log package calling it.
+	f := lw.f
+	var caller *runtime.Frame
+	if frame, ok := f.callerFrom(1, "log"); ok {
+		caller = &frame
+		// The frames above the caller have been skipped already.
+		if f.CallerSkip > 0 {
+			fmtr := *f
+			fmtr.CallerSkip = 0
+			f = &fmtr
+		}
+	}
+
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		b, err := f.Format(&logrus.Entry{
+			Data:    logrus.Fields{},
+			Level:   lw.level,
+			Message: string(line),
+			Caller:  caller,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		lw.mu.Lock()
+		_, err = lw.w.Write(b)
+		lw.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
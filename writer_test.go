@@ -0,0 +1,41 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	f := NewFormatter()
+	logger := log.New(f.Writer(&out, logrus.WarnLevel), "", 0)
+
+	logger.Print("first line")
+	logger.Print("second line")
+
+	var messages []interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if want := "WARNING"; got["severity"] != want {
+			t.Errorf("unexpected severity = %v; want = %v", got["severity"], want)
+		}
+		sourceLocation, _ := got["sourceLocation"].(map[string]interface{})
+		if want := "TestWriter"; sourceLocation["function"] != want {
+			t.Errorf("unexpected function = %v; want = %v", sourceLocation["function"], want)
+		}
+		messages = append(messages, got["message"])
+	}
+
+	if len(messages) != 2 || messages[0] != "first line" || messages[1] != "second line" {
+		t.Errorf("unexpected messages = %v", messages)
+	}
+}